@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
+	"linkshort/pkg/apikey"
+	"linkshort/pkg/workspace"
+
+	"analytics-service/metrics"
 	"analytics-service/models"
 	"analytics-service/storage"
 
@@ -13,51 +20,103 @@ import (
 
 // AnalyticsHandler handles analytics-related HTTP requests
 type AnalyticsHandler struct {
-	storage storage.AnalyticsStorage
+	storage    storage.AnalyticsStorage
+	workspaces *workspace.Registry
+	trackToken []byte
 }
 
-// NewAnalyticsHandler creates a new analytics handler
-func NewAnalyticsHandler(s storage.AnalyticsStorage) *AnalyticsHandler {
+// NewAnalyticsHandler creates a new analytics handler. Click events must
+// carry trackToken, the secret shared with the URL service; without one
+// only clicks of the default workspace are accepted, since anyone could
+// send them.
+func NewAnalyticsHandler(s storage.AnalyticsStorage, workspaces *workspace.Registry, trackToken string) *AnalyticsHandler {
 	return &AnalyticsHandler{
-		storage: s,
+		storage:    s,
+		workspaces: workspaces,
+		trackToken: []byte(trackToken),
 	}
 }
 
+// trusted reports whether a track request carries the shared token
+func (h *AnalyticsHandler) trusted(r *http.Request) bool {
+	return len(h.trackToken) > 0 && subtle.ConstantTimeCompare([]byte(apikey.FromRequest(r)), h.trackToken) == 1
+}
+
 // TrackClick handles POST /track requests
 func (h *AnalyticsHandler) TrackClick(w http.ResponseWriter, r *http.Request) {
+	trusted := h.trusted(r)
+	if len(h.trackToken) > 0 && !trusted {
+		http.Error(w, "Invalid track token", http.StatusUnauthorized)
+		metrics.ClickFailed("unauthorized")
+		return
+	}
+
 	var req models.TrackRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		metrics.ClickFailed("invalid_body")
 		return
 	}
 
 	if req.ShortCode == "" {
 		http.Error(w, "short_code is required", http.StatusBadRequest)
+		metrics.ClickFailed("invalid_body")
+		return
+	}
+	switch req.Outcome {
+	case "", models.ClickOutcomeAllowed, models.ClickOutcomeRejected:
+	default:
+		http.Error(w, "Invalid outcome", http.StatusBadRequest)
+		metrics.ClickFailed("invalid_body")
 		return
 	}
+	if req.Workspace != workspace.Default {
+		if !trusted {
+			http.Error(w, "Workspace clicks require the track token", http.StatusForbidden)
+			metrics.ClickFailed("unauthorized")
+			return
+		}
+		if _, ok := h.workspaces.Find(req.Workspace); !ok {
+			http.Error(w, "Unknown workspace", http.StatusBadRequest)
+			metrics.ClickFailed("invalid_body")
+			return
+		}
+	}
 
 	event := &models.ClickEvent{
 		ShortCode: req.ShortCode,
+		Domain:    strings.ToLower(req.Domain),
+		Workspace: req.Workspace,
 		Timestamp: time.Now(),
 		UserAgent: req.UserAgent,
 		Referrer:  req.Referrer,
+
+		DestinationVersion: req.DestinationVersion,
+		Outcome:            req.Outcome,
+		RuleID:             req.RuleID,
+		Variant:            req.Variant,
+		UTM:                req.UTM,
 	}
 
-	if err := h.storage.SaveClick(event); err != nil {
+	if err := h.storage.SaveClick(r.Context(), event); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save click", "short_code", req.ShortCode, "error", err)
 		http.Error(w, "Failed to track click", http.StatusInternalServerError)
+		metrics.ClickFailed("storage")
 		return
 	}
+	metrics.ClickRecorded()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// GetStats handles GET /stats/{shortCode} requests
+// GetStats handles GET /stats/{shortCode}?domain= requests for a link of the
+// caller's workspace; links on the default domain need no domain
 func (h *AnalyticsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	shortCode := vars["shortCode"]
+	key := models.LinkKey(strings.ToLower(r.URL.Query().Get("domain")), vars["shortCode"])
 
-	stats, err := h.storage.GetStatsByShortCode(shortCode)
+	stats, err := h.storage.GetStatsByShortCode(r.Context(), key)
 	if err != nil {
 		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
 		return
@@ -67,9 +126,9 @@ func (h *AnalyticsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
-// GetAllStats handles GET /stats requests
+// GetAllStats handles GET /stats requests for the caller's workspace
 func (h *AnalyticsHandler) GetAllStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := h.storage.GetAllStats()
+	stats, err := h.storage.GetAllStats(r.Context())
 	if err != nil {
 		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
 		return
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"linkshort/pkg/workspace"
+
+	"analytics-service/storage"
+)
+
+func TestTrackClickWorkspace(t *testing.T) {
+	registry, err := workspace.NewRegistry([]workspace.Workspace{{ID: "acme"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string // configured on the service
+		sent      string // sent with the request
+		workspace string
+		wantCode  int
+	}{
+		{"default workspace without a token", "", "", "", http.StatusOK},
+		{"workspace without a token", "", "", "acme", http.StatusForbidden},
+		{"workspace with a forged token", "", "guess", "acme", http.StatusForbidden},
+		{"missing token", "secret", "", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "guess", "acme", http.StatusUnauthorized},
+		{"workspace with the token", "secret", "secret", "acme", http.StatusOK},
+		{"unknown workspace", "secret", "secret", "other", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStorage()
+			h := NewAnalyticsHandler(store, registry, tt.token)
+
+			body := `{"short_code":"abc123","workspace":"` + tt.workspace + `"}`
+			r := httptest.NewRequest(http.MethodPost, "/track", strings.NewReader(body))
+			if tt.sent != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.sent)
+			}
+			w := httptest.NewRecorder()
+			h.TrackClick(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+
+			ctx := workspace.NewContext(context.Background(), tt.workspace)
+			stats, err := store.GetStatsByShortCode(ctx, "abc123")
+			recorded := err == nil && stats.TotalClicks == 1
+			if recorded != (tt.wantCode == http.StatusOK) {
+				t.Errorf("click recorded = %v, want %v", recorded, tt.wantCode == http.StatusOK)
+			}
+		})
+	}
+}
@@ -1,31 +1,33 @@
 package main
 
 import (
-	"log"
+	"context"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"linkshort/pkg/health"
+	"linkshort/pkg/logging"
+	httpmetrics "linkshort/pkg/metrics"
+	"linkshort/pkg/middleware"
+	"linkshort/pkg/ratelimit"
+	"linkshort/pkg/redisconfig"
+	"linkshort/pkg/workspace"
 
 	"analytics-service/handlers"
+	"analytics-service/metrics"
 	"analytics-service/storage"
+	"analytics-service/tracing"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func initStorage() storage.AnalyticsStorage {
 	storageType := os.Getenv("STORAGE_TYPE")
 	redisURL := os.Getenv("REDIS_URL")
@@ -34,38 +36,135 @@ func initStorage() storage.AnalyticsStorage {
 		if redisURL == "" {
 			redisURL = "localhost:6379"
 		}
-		log.Printf("Initializing Redis storage at %s", redisURL)
-		store, err := storage.NewRedisStorage(redisURL)
+		opts, err := redisconfig.OptionsFromEnv(redisURL)
 		if err != nil {
-			log.Printf("Failed to connect to Redis: %v, falling back to memory storage", err)
+			slog.Warn("Invalid Redis configuration, falling back to memory storage", "error", err)
 			return storage.NewMemoryStorage()
 		}
-		log.Println("Redis storage initialized successfully")
+		slog.Info("Initializing Redis storage", "addrs", strings.Join(opts.Addrs, ","))
+		store, err := storage.NewRedisStorage(opts)
+		if err != nil {
+			slog.Warn("Failed to connect to Redis, falling back to memory storage", "error", err)
+			return storage.NewMemoryStorage()
+		}
+		slog.Info("Redis storage initialized successfully")
 		return store
 	}
 
-	log.Println("Using in-memory storage")
+	slog.Info("Using in-memory storage")
 	return storage.NewMemoryStorage()
 }
 
+// migrateKeys moves click lists stored before their keys carried hash tags
+// to the current names
+func migrateKeys(store storage.AnalyticsStorage, workspaces *workspace.Registry) {
+	redisStore, ok := store.(*storage.RedisStorage)
+	if !ok {
+		return
+	}
+	renamed, err := redisStore.MigrateClickKeys(context.Background(), workspaces.IDs())
+	if err != nil {
+		slog.Error("Failed to migrate Redis keys", "error", err)
+		os.Exit(1)
+	}
+	if renamed > 0 {
+		slog.Info("Migrated Redis keys to per-link hash tags", "keys", renamed)
+	}
+}
+
+// initRateLimiter shares token buckets through Redis when it is the storage
+// backend, otherwise limits apply per replica. Click tracking comes from the
+// URL service and is never limited here.
+func initRateLimiter(store storage.AnalyticsStorage, workspaces *workspace.Registry) *ratelimit.RateLimiter {
+	cfg, err := ratelimit.ConfigFromEnv(map[string]ratelimit.Policy{
+		"stats": {
+			Anonymous: ratelimit.Rule{Rate: 5, Burst: 20},
+			Keyed:     ratelimit.Rule{Rate: 20, Burst: 50},
+		},
+	})
+	if err != nil {
+		slog.Error("Invalid rate limit configuration", "error", err)
+		os.Exit(1)
+	}
+	if !cfg.Enabled {
+		slog.Info("Rate limiting disabled")
+		return nil
+	}
+	// Workspace keys are as much known clients as those in API_KEYS
+	for key := range workspaces.Keys() {
+		cfg.APIKeys = append(cfg.APIKeys, key)
+	}
+
+	if redisStore, ok := store.(*storage.RedisStorage); ok {
+		slog.Info("Rate limiting enabled", "backend", "redis")
+		return ratelimit.New(ratelimit.NewRedisLimiter(redisStore.Client()), cfg)
+	}
+	slog.Info("Rate limiting enabled", "backend", "memory")
+	return ratelimit.New(ratelimit.NewMemoryLimiter(), cfg)
+}
+
 func main() {
+	if err := logging.Setup("analytics-service"); err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize tracing before anything that creates spans
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+
+	workspaces, err := workspace.RegistryFromEnv()
+	if err != nil {
+		slog.Error("Invalid workspace configuration", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize storage based on STORAGE_TYPE environment variable
 	store := initStorage()
+	migrateKeys(store, workspaces)
+	limiter := initRateLimiter(store, workspaces)
+	middleware.TrustProxyHeaders = os.Getenv("TRUST_PROXY_HEADERS") == "true"
+
+	backend := "memory"
+	if _, ok := store.(*storage.RedisStorage); ok {
+		backend = "redis"
+	}
+	instrumented := tracing.TraceStorage(metrics.InstrumentStorage(store, backend))
 
 	// Initialize handlers
-	analyticsHandler := handlers.NewAnalyticsHandler(store)
+	trackToken := os.Getenv("ANALYTICS_TRACK_TOKEN")
+	if trackToken == "" && len(workspaces.IDs()) > 1 {
+		slog.Warn("ANALYTICS_TRACK_TOKEN is not set, clicks of configured workspaces will be rejected")
+	}
+	analyticsHandler := handlers.NewAnalyticsHandler(instrumented, workspaces, trackToken)
+	var checks []health.DependencyCheck
+	if pinger, ok := store.(storage.Pinger); ok {
+		checks = append(checks, health.DependencyCheck{Name: "storage", Critical: true, Check: pinger.Ping})
+	} else {
+		slog.Warn("Storage cannot be pinged, readiness does not check it")
+	}
+	healthHandler := health.NewHandler(checks...)
 
 	// Setup router
 	r := mux.NewRouter()
 
 	// Routes
 	r.HandleFunc("/health", analyticsHandler.HealthCheck).Methods("GET")
+	r.HandleFunc("/healthz", healthHandler.Liveness).Methods("GET")
+	r.HandleFunc("/readyz", healthHandler.Readiness).Methods("GET")
 	r.HandleFunc("/track", analyticsHandler.TrackClick).Methods("POST", "OPTIONS")
-	r.HandleFunc("/stats", analyticsHandler.GetAllStats).Methods("GET", "OPTIONS")
-	r.HandleFunc("/stats/{shortCode}", analyticsHandler.GetStats).Methods("GET", "OPTIONS")
+	r.Handle("/stats", limiter.Limit("stats", analyticsHandler.GetAllStats)).Methods("GET", "OPTIONS")
+	r.Handle("/stats/{shortCode}", limiter.Limit("stats", analyticsHandler.GetStats)).Methods("GET", "OPTIONS")
+	r.Use(otelmux.Middleware(tracing.ServiceName), logging.RouteTemplate)
 
-	// Apply CORS middleware
-	handler := corsMiddleware(r)
+	// Count every request the router sees, including unmatched ones, identify
+	// the caller's workspace, apply CORS middleware, then request IDs and
+	// access logging around everything
+	cors := middleware.NewCORS(middleware.CORSConfigFromEnv())
+	handler := logging.RequestID(logging.AccessLog(cors.Handler(workspaces.Identify(httpmetrics.Instrument(r)))))
 
 	// Get port from environment or default
 	port := os.Getenv("PORT")
@@ -73,8 +172,76 @@ func main() {
 		port = "8081"
 	}
 
-	log.Printf("Analytics Service starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: envDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       envDuration("HTTP_READ_TIMEOUT", 10*time.Second),
+		WriteTimeout:      envDuration("HTTP_WRITE_TIMEOUT", 10*time.Second),
+		IdleTimeout:       envDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+	}
+
+	// Metrics are served on a port of their own that is never exposed publicly
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9090"
+	}
+	metricsSrv := httpmetrics.NewServer(":" + metricsPort)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		slog.Info("Analytics Service starting", "port", port)
+		serverErr <- srv.ListenAndServe()
+	}()
+	go func() {
+		slog.Info("Metrics listening", "port", metricsPort)
+		serverErr <- metricsSrv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		slog.Error("Failed to start server", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Stop accepting requests and let in-flight clicks be stored before
+	// closing storage
+	shutdownTimeout := envDuration("SHUTDOWN_TIMEOUT", 20*time.Second)
+	slog.Info("Shutting down", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	healthHandler.SetDraining()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("HTTP server did not drain in time", "error", err)
+	}
+	metricsSrv.Shutdown(shutdownCtx)
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Warn("Failed to close storage", "error", err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+	slog.Info("Analytics Service stopped")
+}
+
+// envDuration reads a duration such as "15s" from the environment
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid duration", "key", key, "value", value)
+		return fallback
 	}
+	return d
 }
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "linkshort"
+
+var (
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Storage operation latency by backend and operation.",
+		Buckets:   []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"backend", "operation"})
+
+	storageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_errors_total",
+		Help:      "Failed storage operations by backend and operation.",
+	}, []string{"backend", "operation"})
+
+	clicksRecorded = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clicks_recorded_total",
+		Help:      "Click events stored by the analytics service.",
+	})
+
+	clickFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "click_tracking_failures_total",
+		Help:      "Click events that could not be recorded, by reason.",
+	}, []string{"reason"})
+)
+
+// ClickRecorded counts a stored click event
+func ClickRecorded() {
+	clicksRecorded.Inc()
+}
+
+// ClickFailed counts a click event that could not be recorded
+func ClickFailed(reason string) {
+	clickFailures.WithLabelValues(reason).Inc()
+}
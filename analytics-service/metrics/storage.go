@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"analytics-service/models"
+	"analytics-service/storage"
+)
+
+// InstrumentedStorage is an AnalyticsStorage decorator that records latency
+// and errors for every call to the wrapped backend
+type InstrumentedStorage struct {
+	next    storage.AnalyticsStorage
+	backend string
+}
+
+// InstrumentStorage wraps a backend, labelling its metrics with the backend name
+func InstrumentStorage(next storage.AnalyticsStorage, backend string) *InstrumentedStorage {
+	return &InstrumentedStorage{next: next, backend: backend}
+}
+
+func (s *InstrumentedStorage) observe(operation string, start time.Time, err error) {
+	storageDuration.WithLabelValues(s.backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		storageErrors.WithLabelValues(s.backend, operation).Inc()
+	}
+}
+
+// SaveClick stores a click event
+func (s *InstrumentedStorage) SaveClick(ctx context.Context, event *models.ClickEvent) error {
+	start := time.Now()
+	err := s.next.SaveClick(ctx, event)
+	s.observe("save_click", start, err)
+	return err
+}
+
+// GetStatsByShortCode retrieves stats for a specific short code
+func (s *InstrumentedStorage) GetStatsByShortCode(ctx context.Context, shortCode string) (*models.Stats, error) {
+	start := time.Now()
+	stats, err := s.next.GetStatsByShortCode(ctx, shortCode)
+	s.observe("get_stats_by_short_code", start, err)
+	return stats, err
+}
+
+// GetAllStats retrieves stats for all short codes
+func (s *InstrumentedStorage) GetAllStats(ctx context.Context) ([]*models.Stats, error) {
+	start := time.Now()
+	stats, err := s.next.GetAllStats(ctx)
+	s.observe("get_all_stats", start, err)
+	return stats, err
+}
@@ -1,31 +1,212 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// Click outcomes. Clicks tracked before outcomes existed have none and count
+// as allowed.
+const (
+	ClickOutcomeAllowed = "allowed"
+	// ClickOutcomeRejected is a visit refused because the link reached its
+	// click limit
+	ClickOutcomeRejected = "rejected"
+)
 
 // ClickEvent represents a single click on a shortened URL
 type ClickEvent struct {
 	ID        string    `json:"id"`
 	ShortCode string    `json:"short_code"`
+	Domain    string    `json:"domain,omitempty"`
+	Workspace string    `json:"workspace,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 	UserAgent string    `json:"user_agent"`
 	Referrer  string    `json:"referrer"`
+	// DestinationVersion is the link version that served the click, so
+	// traffic can be attributed to each destination a link has pointed to
+	DestinationVersion int `json:"destination_version,omitempty"`
+	// Outcome is ClickOutcomeAllowed or ClickOutcomeRejected
+	Outcome string `json:"outcome,omitempty"`
+	// RuleID names the redirect rule that chose the destination, empty when
+	// the link's own destination was used
+	RuleID string `json:"rule_id,omitempty"`
+	// Variant names the A/B variant the visitor was sent to
+	Variant string `json:"variant,omitempty"`
+	// UTM holds the campaign parameters of the destination the visitor was
+	// sent to
+	UTM *UTM `json:"utm,omitempty"`
+}
+
+// UTM holds the campaign parameters of a click
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// dimensions pairs each UTM dimension name with its value
+func (u *UTM) dimensions() [5][2]string {
+	return [5][2]string{
+		{"source", u.Source},
+		{"medium", u.Medium},
+		{"campaign", u.Campaign},
+		{"term", u.Term},
+		{"content", u.Content},
+	}
+}
+
+// Rejected reports whether the visit was refused rather than redirected
+func (c *ClickEvent) Rejected() bool {
+	return c.Outcome == ClickOutcomeRejected
 }
 
 // TrackRequest is the request body for tracking a click
 type TrackRequest struct {
 	ShortCode string `json:"short_code"`
+	// Domain is the registered short domain of the link, empty for the
+	// default domain
+	Domain string `json:"domain,omitempty"`
+	// Workspace owns the link, empty for the default workspace
+	Workspace string `json:"workspace,omitempty"`
 	UserAgent string `json:"user_agent"`
 	Referrer  string `json:"referrer"`
+
+	DestinationVersion int    `json:"destination_version,omitempty"`
+	Outcome            string `json:"outcome,omitempty"`
+	RuleID             string `json:"rule_id,omitempty"`
+	Variant            string `json:"variant,omitempty"`
+	UTM                *UTM   `json:"utm,omitempty"`
 }
 
 // Stats represents statistics for a short code
 type Stats struct {
-	ShortCode   string        `json:"short_code"`
-	TotalClicks int           `json:"total_clicks"`
-	Clicks      []*ClickEvent `json:"clicks,omitempty"`
+	ShortCode string `json:"short_code"`
+	Domain    string `json:"domain,omitempty"`
+	// TotalClicks counts the visits that were redirected
+	TotalClicks int `json:"total_clicks"`
+	// RejectedClicks counts visits refused because the link reached its
+	// click limit; they are not part of TotalClicks
+	RejectedClicks int           `json:"rejected_clicks,omitempty"`
+	Clicks         []*ClickEvent `json:"clicks,omitempty"`
+	// ClicksByVersion counts redirected clicks per destination version;
+	// clicks tracked before versioning are counted under version 1
+	ClicksByVersion map[int]int `json:"clicks_by_version,omitempty"`
+	// ClicksByRule counts redirected clicks per redirect rule that fired
+	ClicksByRule map[string]int `json:"clicks_by_rule,omitempty"`
+	// ClicksByUTM counts redirected clicks per value of each UTM dimension,
+	// such as {"source": {"newsletter": 12}}
+	ClicksByUTM map[string]map[string]int `json:"clicks_by_utm,omitempty"`
+	// Variants breaks clicks down per A/B variant
+	Variants map[string]*VariantStats `json:"variants,omitempty"`
+}
+
+// VariantStats summarises the clicks one A/B variant received
+type VariantStats struct {
+	Clicks int `json:"clicks"`
+	// Share is the variant's fraction of all variant clicks
+	Share      float64   `json:"share"`
+	FirstClick time.Time `json:"first_click"`
+	LastClick  time.Time `json:"last_click"`
+}
+
+// NewStats aggregates the clicks recorded for the link key
+func NewStats(key string, clicks []*ClickEvent) *Stats {
+	domain, shortCode := SplitLinkKey(key)
+	stats := &Stats{
+		ShortCode: shortCode,
+		Domain:    domain,
+		Clicks:    clicks,
+	}
+	if len(clicks) > 0 {
+		stats.ClicksByVersion = make(map[int]int)
+	}
+	for _, click := range clicks {
+		if click.Rejected() {
+			stats.RejectedClicks++
+			continue
+		}
+		stats.TotalClicks++
+		stats.ClicksByVersion[max(click.DestinationVersion, 1)]++
+		if click.RuleID != "" {
+			if stats.ClicksByRule == nil {
+				stats.ClicksByRule = make(map[string]int)
+			}
+			stats.ClicksByRule[click.RuleID]++
+		}
+		if click.Variant != "" {
+			stats.addVariantClick(click)
+		}
+		if click.UTM != nil {
+			stats.addUTMClick(click.UTM)
+		}
+	}
+
+	variantClicks := 0
+	for _, v := range stats.Variants {
+		variantClicks += v.Clicks
+	}
+	for _, v := range stats.Variants {
+		v.Share = float64(v.Clicks) / float64(variantClicks)
+	}
+	return stats
+}
+
+func (s *Stats) addUTMClick(utm *UTM) {
+	for _, dim := range utm.dimensions() {
+		dimension, value := dim[0], dim[1]
+		if value == "" {
+			continue
+		}
+		if s.ClicksByUTM == nil {
+			s.ClicksByUTM = make(map[string]map[string]int)
+		}
+		if s.ClicksByUTM[dimension] == nil {
+			s.ClicksByUTM[dimension] = make(map[string]int)
+		}
+		s.ClicksByUTM[dimension][value]++
+	}
+}
+
+func (s *Stats) addVariantClick(click *ClickEvent) {
+	if s.Variants == nil {
+		s.Variants = make(map[string]*VariantStats)
+	}
+	v, ok := s.Variants[click.Variant]
+	if !ok {
+		v = &VariantStats{FirstClick: click.Timestamp, LastClick: click.Timestamp}
+		s.Variants[click.Variant] = v
+	}
+	v.Clicks++
+	if click.Timestamp.Before(v.FirstClick) {
+		v.FirstClick = click.Timestamp
+	}
+	if click.Timestamp.After(v.LastClick) {
+		v.LastClick = click.Timestamp
+	}
 }
 
 // StatsResponse is the response for all stats
 type AllStatsResponse struct {
 	Stats []*Stats `json:"stats"`
 }
+
+// LinkKey identifies a link's clicks in storage. Short codes are unique per
+// domain, so links on a registered domain are keyed "<domain>/<code>";
+// links on the default domain keep their bare code.
+func LinkKey(domain, shortCode string) string {
+	if domain == "" {
+		return shortCode
+	}
+	return domain + "/" + shortCode
+}
+
+// SplitLinkKey is the inverse of LinkKey
+func SplitLinkKey(key string) (domain, shortCode string) {
+	if domain, shortCode, found := strings.Cut(key, "/"); found {
+		return domain, shortCode
+	}
+	return "", key
+}
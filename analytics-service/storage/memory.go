@@ -1,9 +1,12 @@
 package storage
 
 import (
+	"context"
 	"sync"
 	"time"
 
+	"linkshort/pkg/workspace"
+
 	"analytics-service/models"
 
 	"github.com/google/uuid"
@@ -11,27 +14,37 @@ import (
 
 // AnalyticsStorage defines the interface for analytics storage operations
 // This interface allows easy extension to other storage backends
+// Clicks are saved in the workspace of their event and read from the
+// workspace of the context.
 type AnalyticsStorage interface {
-	SaveClick(event *models.ClickEvent) error
-	GetStatsByShortCode(shortCode string) (*models.Stats, error)
-	GetAllStats() ([]*models.Stats, error)
+	SaveClick(ctx context.Context, event *models.ClickEvent) error
+	// GetStatsByShortCode aggregates the clicks of a link key, see
+	// models.LinkKey
+	GetStatsByShortCode(ctx context.Context, key string) (*models.Stats, error)
+	GetAllStats(ctx context.Context) ([]*models.Stats, error)
+}
+
+// Pinger is implemented by storage backends that can report whether they are
+// reachable, for readiness probes
+type Pinger interface {
+	Ping(ctx context.Context) error
 }
 
 // MemoryStorage implements AnalyticsStorage using an in-memory map
 type MemoryStorage struct {
 	mu     sync.RWMutex
-	clicks map[string][]*models.ClickEvent // shortCode -> list of clicks
+	clicks map[string]map[string][]*models.ClickEvent // workspace -> link key -> list of clicks
 }
 
 // NewMemoryStorage creates a new in-memory analytics storage instance
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		clicks: make(map[string][]*models.ClickEvent),
+		clicks: make(map[string]map[string][]*models.ClickEvent),
 	}
 }
 
 // SaveClick stores a click event in memory
-func (s *MemoryStorage) SaveClick(event *models.ClickEvent) error {
+func (s *MemoryStorage) SaveClick(ctx context.Context, event *models.ClickEvent) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -42,43 +55,53 @@ func (s *MemoryStorage) SaveClick(event *models.ClickEvent) error {
 		event.Timestamp = time.Now()
 	}
 
-	s.clicks[event.ShortCode] = append(s.clicks[event.ShortCode], event)
+	links := s.clicks[event.Workspace]
+	if links == nil {
+		links = make(map[string][]*models.ClickEvent)
+		s.clicks[event.Workspace] = links
+	}
+	key := models.LinkKey(event.Domain, event.ShortCode)
+	links[key] = append(links[key], event)
 	return nil
 }
 
 // GetStatsByShortCode retrieves stats for a specific short code
-func (s *MemoryStorage) GetStatsByShortCode(shortCode string) (*models.Stats, error) {
+func (s *MemoryStorage) GetStatsByShortCode(ctx context.Context, key string) (*models.Stats, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	clicks, exists := s.clicks[shortCode]
+	clicks, exists := s.clicks[workspace.FromContext(ctx)][key]
 	if !exists {
-		return &models.Stats{
-			ShortCode:   shortCode,
-			TotalClicks: 0,
-			Clicks:      []*models.ClickEvent{},
-		}, nil
+		return models.NewStats(key, []*models.ClickEvent{}), nil
 	}
 
-	return &models.Stats{
-		ShortCode:   shortCode,
-		TotalClicks: len(clicks),
-		Clicks:      clicks,
-	}, nil
+	return models.NewStats(key, clicks), nil
 }
 
 // GetAllStats retrieves stats for all short codes
-func (s *MemoryStorage) GetAllStats() ([]*models.Stats, error) {
+func (s *MemoryStorage) GetAllStats(ctx context.Context) ([]*models.Stats, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	stats := make([]*models.Stats, 0, len(s.clicks))
-	for shortCode, clicks := range s.clicks {
-		stats = append(stats, &models.Stats{
-			ShortCode:   shortCode,
-			TotalClicks: len(clicks),
-		})
+	links := s.clicks[workspace.FromContext(ctx)]
+	stats := make([]*models.Stats, 0, len(links))
+	for key, clicks := range links {
+		domain, shortCode := models.SplitLinkKey(key)
+		link := &models.Stats{ShortCode: shortCode, Domain: domain}
+		for _, click := range clicks {
+			if click.Rejected() {
+				link.RejectedClicks++
+			} else {
+				link.TotalClicks++
+			}
+		}
+		stats = append(stats, link)
 	}
 
 	return stats, nil
 }
+
+// Ping always succeeds because in-memory storage has no external dependency
+func (s *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
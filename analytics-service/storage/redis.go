@@ -5,46 +5,66 @@ import (
 	"encoding/json"
 	"time"
 
+	"linkshort/pkg/workspace"
+
 	"analytics-service/models"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
 const (
 	clickKeyPrefix = "clicks:"
-	statsListKey   = "stats:list"
+	// rejectedKeyPrefix counts the rejected events in a link's click list,
+	// so GetAllStats can tell them apart without reading the list
+	rejectedKeyPrefix = "rejected:"
+	statsListKey      = "stats:list"
 )
 
 // RedisStorage implements AnalyticsStorage using Redis
+// It works against a single node, a Sentinel-managed failover group or a
+// Redis Cluster, depending on the options it was created with.
 type RedisStorage struct {
-	client *redis.Client
-	ctx    context.Context
+	client redis.UniversalClient
 }
 
 // NewRedisStorage creates a new Redis analytics storage instance
-func NewRedisStorage(addr string) (*RedisStorage, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: "",
-		DB:       0,
-	})
+func NewRedisStorage(opts *redis.UniversalOptions) (*RedisStorage, error) {
+	client := redis.NewUniversalClient(opts)
+	if err := redisotel.InstrumentTracing(client); err != nil {
+		client.Close()
+		return nil, err
+	}
 
 	ctx := context.Background()
 
 	// Test connection
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, err
 	}
 
 	return &RedisStorage{
 		client: client,
-		ctx:    ctx,
 	}, nil
 }
 
+// clicksKey names the click list of a link in workspace ws,
+// "clicks:{<key>}". The braces make the link key the hash tag, as for the
+// URL service's keys, so links spread across the slots of a Redis Cluster.
+func clicksKey(ws, linkKey string) string {
+	return workspace.KeyPrefix(ws) + clickKeyPrefix + "{" + linkKey + "}"
+}
+
+// rejectedKey names the rejected click counter of a link, in the slot of its
+// click list
+func rejectedKey(ws, linkKey string) string {
+	return workspace.KeyPrefix(ws) + rejectedKeyPrefix + "{" + linkKey + "}"
+}
+
 // SaveClick stores a click event in Redis
-func (s *RedisStorage) SaveClick(event *models.ClickEvent) error {
+func (s *RedisStorage) SaveClick(ctx context.Context, event *models.ClickEvent) error {
 	if event.ID == "" {
 		event.ID = uuid.New().String()
 	}
@@ -57,26 +77,30 @@ func (s *RedisStorage) SaveClick(event *models.ClickEvent) error {
 		return err
 	}
 
-	key := clickKeyPrefix + event.ShortCode
+	linkKey := models.LinkKey(event.Domain, event.ShortCode)
 
-	// Store click event in a list
-	if err := s.client.RPush(s.ctx, key, data).Err(); err != nil {
+	// Add short code to tracking set first; the set lives in another slot
+	// on Redis Cluster, and a tracked link without clicks reads as zero
+	if err := s.client.SAdd(ctx, workspace.KeyPrefix(event.Workspace)+statsListKey, linkKey).Err(); err != nil {
 		return err
 	}
-
-	// Add short code to tracking set
-	if err := s.client.SAdd(s.ctx, statsListKey, event.ShortCode).Err(); err != nil {
-		return err
+	// Store click event in a list
+	if !event.Rejected() {
+		return s.client.RPush(ctx, clicksKey(event.Workspace, linkKey), data).Err()
 	}
-
-	return nil
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, clicksKey(event.Workspace, linkKey), data)
+		pipe.Incr(ctx, rejectedKey(event.Workspace, linkKey))
+		return nil
+	})
+	return err
 }
 
-// GetStatsByShortCode retrieves stats for a specific short code
-func (s *RedisStorage) GetStatsByShortCode(shortCode string) (*models.Stats, error) {
-	key := clickKeyPrefix + shortCode
+// GetStatsByShortCode retrieves stats for a specific link key
+func (s *RedisStorage) GetStatsByShortCode(ctx context.Context, linkKey string) (*models.Stats, error) {
+	key := clicksKey(workspace.FromContext(ctx), linkKey)
 
-	clickData, err := s.client.LRange(s.ctx, key, 0, -1).Result()
+	clickData, err := s.client.LRange(ctx, key, 0, -1).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -89,37 +113,57 @@ func (s *RedisStorage) GetStatsByShortCode(shortCode string) (*models.Stats, err
 		}
 	}
 
-	return &models.Stats{
-		ShortCode:   shortCode,
-		TotalClicks: len(clicks),
-		Clicks:      clicks,
-	}, nil
+	return models.NewStats(linkKey, clicks), nil
 }
 
-// GetAllStats retrieves stats for all short codes
-func (s *RedisStorage) GetAllStats() ([]*models.Stats, error) {
-	shortCodes, err := s.client.SMembers(s.ctx, statsListKey).Result()
+// GetAllStats retrieves stats for all short codes of the context's workspace
+func (s *RedisStorage) GetAllStats(ctx context.Context) ([]*models.Stats, error) {
+	ws := workspace.FromContext(ctx)
+	linkKeys, err := s.client.SMembers(ctx, workspace.KeyPrefix(ws)+statsListKey).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	stats := make([]*models.Stats, 0, len(shortCodes))
-	for _, shortCode := range shortCodes {
-		key := clickKeyPrefix + shortCode
-		count, err := s.client.LLen(s.ctx, key).Result()
-		if err != nil {
-			continue
+	// Count every click list and its rejected clicks in a single round-trip
+	lengths := make([]*redis.IntCmd, len(linkKeys))
+	rejected := make([]*redis.StringCmd, len(linkKeys))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, linkKey := range linkKeys {
+			lengths[i] = pipe.LLen(ctx, clicksKey(ws, linkKey))
+			rejected[i] = pipe.Get(ctx, rejectedKey(ws, linkKey))
 		}
+		return nil
+	})
+	// Links without rejected clicks have no counter
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
 
+	stats := make([]*models.Stats, 0, len(linkKeys))
+	for i, linkKey := range linkKeys {
+		domain, shortCode := models.SplitLinkKey(linkKey)
+		refused, _ := rejected[i].Int()
 		stats = append(stats, &models.Stats{
-			ShortCode:   shortCode,
-			TotalClicks: int(count),
+			ShortCode:      shortCode,
+			Domain:         domain,
+			TotalClicks:    int(lengths[i].Val()) - refused,
+			RejectedClicks: refused,
 		})
 	}
 
 	return stats, nil
 }
 
+// Client exposes the connection so other components can share its pool
+func (s *RedisStorage) Client() redis.UniversalClient {
+	return s.client
+}
+
+// Ping checks that Redis is reachable
+func (s *RedisStorage) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
 // Close closes the Redis connection
 func (s *RedisStorage) Close() error {
 	return s.client.Close()
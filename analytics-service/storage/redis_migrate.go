@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"linkshort/pkg/workspace"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// clickKeysMigratedKey records that MigrateClickKeys has run
+const clickKeysMigratedKey = "migrations:click-hash-tags"
+
+// MigrateClickKeys renames the click lists of workspaces from the names used
+// before they carried a hash tag ("clicks:<key>") to clicksKey's
+// ("clicks:{<key>}"). It runs once per Redis; a list that already exists
+// under its new name is left alone. Redis Cluster is skipped: renames across
+// slots are not possible there, and cluster support came with the hash tags.
+// It returns how many lists were renamed.
+func (s *RedisStorage) MigrateClickKeys(ctx context.Context, workspaces []string) (int, error) {
+	if _, ok := s.client.(*redis.ClusterClient); ok {
+		return 0, nil
+	}
+	done, err := s.client.Exists(ctx, clickKeysMigratedKey).Result()
+	if err != nil || done > 0 {
+		return 0, err
+	}
+
+	renamed := 0
+	for _, ws := range workspaces {
+		prefix := workspace.KeyPrefix(ws)
+		linkKeys, err := s.client.SMembers(ctx, prefix+statsListKey).Result()
+		if err != nil {
+			return renamed, err
+		}
+
+		cmds := make([]*redis.BoolCmd, len(linkKeys))
+		_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, linkKey := range linkKeys {
+				cmds[i] = pipe.RenameNX(ctx, prefix+clickKeyPrefix+linkKey, clicksKey(ws, linkKey))
+			}
+			return nil
+		})
+		// Links tracked without clicks have no list, which RENAMENX reports
+		// as an error
+		if err != nil && !isNoSuchKey(err) {
+			return renamed, err
+		}
+		for _, cmd := range cmds {
+			if err := cmd.Err(); err != nil && !isNoSuchKey(err) {
+				return renamed, err
+			}
+			if cmd.Val() {
+				renamed++
+			}
+		}
+	}
+
+	return renamed, s.client.Set(ctx, clickKeysMigratedKey, 1, 0).Err()
+}
+
+func isNoSuchKey(err error) bool {
+	return strings.Contains(err.Error(), "no such key")
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"analytics-service/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// backends returns every AnalyticsStorage implementation
+func backends(t *testing.T) map[string]AnalyticsStorage {
+	redisStore, err := NewRedisStorage(&redis.UniversalOptions{Addrs: []string{miniredis.RunT(t).Addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { redisStore.Close() })
+	return map[string]AnalyticsStorage{
+		"memory": NewMemoryStorage(),
+		"redis":  redisStore,
+	}
+}
+
+func TestRejectedClicksCountedApart(t *testing.T) {
+	for name, store := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, outcome := range []string{"", models.ClickOutcomeAllowed, models.ClickOutcomeRejected, models.ClickOutcomeRejected} {
+				if err := store.SaveClick(ctx, &models.ClickEvent{ShortCode: "abc123", Outcome: outcome}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.SaveClick(ctx, &models.ClickEvent{ShortCode: "other"}); err != nil {
+				t.Fatal(err)
+			}
+
+			stats, err := store.GetStatsByShortCode(ctx, "abc123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.TotalClicks != 2 || stats.RejectedClicks != 2 || len(stats.Clicks) != 4 {
+				t.Errorf("stats = %d total, %d rejected, %d events; want 2, 2, 4",
+					stats.TotalClicks, stats.RejectedClicks, len(stats.Clicks))
+			}
+
+			all, err := store.GetAllStats(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string][2]int)
+			for _, s := range all {
+				got[s.ShortCode] = [2]int{s.TotalClicks, s.RejectedClicks}
+			}
+			if got["abc123"] != [2]int{2, 2} || got["other"] != [2]int{1, 0} {
+				t.Errorf("GetAllStats total and rejected = %v", got)
+			}
+		})
+	}
+}
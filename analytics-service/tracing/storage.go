@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+
+	"analytics-service/models"
+	"analytics-service/storage"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedStorage is an AnalyticsStorage decorator that wraps every call in a span
+type TracedStorage struct {
+	next storage.AnalyticsStorage
+}
+
+// TraceStorage wraps a storage with tracing spans
+func TraceStorage(next storage.AnalyticsStorage) *TracedStorage {
+	return &TracedStorage{next: next}
+}
+
+func startSpan(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SaveClick stores a click event
+func (s *TracedStorage) SaveClick(ctx context.Context, event *models.ClickEvent) error {
+	ctx, span := startSpan(ctx, "SaveClick", attribute.String("short_code", event.ShortCode))
+	err := s.next.SaveClick(ctx, event)
+	endSpan(span, err)
+	return err
+}
+
+// GetStatsByShortCode retrieves stats for a specific short code
+func (s *TracedStorage) GetStatsByShortCode(ctx context.Context, shortCode string) (*models.Stats, error) {
+	ctx, span := startSpan(ctx, "GetStatsByShortCode", attribute.String("short_code", shortCode))
+	stats, err := s.next.GetStatsByShortCode(ctx, shortCode)
+	endSpan(span, err)
+	return stats, err
+}
+
+// GetAllStats retrieves stats for all short codes
+func (s *TracedStorage) GetAllStats(ctx context.Context) ([]*models.Stats, error) {
+	ctx, span := startSpan(ctx, "GetAllStats")
+	stats, err := s.next.GetAllStats(ctx)
+	span.SetAttributes(attribute.Int("count", len(stats)))
+	endSpan(span, err)
+	return stats, err
+}
@@ -55,7 +55,9 @@ export default function Home() {
             });
 
             if (!response.ok) {
-                throw new Error('Failed to shorten URL');
+                // Validation failures explain what is wrong with the URL
+                const message = response.status === 400 ? (await response.text()).trim() : '';
+                throw new Error(message || 'Failed to shorten URL. Please try again.');
             }
 
             const data = await response.json();
@@ -63,7 +65,7 @@ export default function Home() {
             setUrl('');
             fetchUrls();
         } catch (err) {
-            setError('Failed to shorten URL. Please try again.');
+            setError(err instanceof Error ? err.message : 'Failed to shorten URL. Please try again.');
         } finally {
             setLoading(false);
         }
@@ -0,0 +1,131 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+// States reported by the probe endpoints
+const (
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+)
+
+// Status is the response body of the liveness and readiness probes
+type Status struct {
+	Status     string                `json:"status"`
+	Draining   bool                  `json:"draining,omitempty"`
+	Components map[string]*Component `json:"components,omitempty"`
+}
+
+// Component is the result of probing a single dependency
+type Component struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// DependencyCheck is a named dependency probed by the readiness endpoint
+type DependencyCheck struct {
+	Name string
+	// Critical checks make the service unready when they fail; non-critical
+	// ones only mark it degraded
+	Critical bool
+	Check    func(ctx context.Context) error
+}
+
+// Handler serves the liveness and readiness probes
+type Handler struct {
+	checks   []DependencyCheck
+	draining atomic.Bool
+}
+
+// NewHandler creates a health handler probing the given dependencies
+func NewHandler(checks ...DependencyCheck) *Handler {
+	return &Handler{checks: checks}
+}
+
+// SetDraining makes readiness fail so the load balancer stops sending
+// traffic while the server shuts down
+func (h *Handler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Liveness handles GET /healthz requests. It only reports that the process
+// can serve HTTP; dependency outages are left to the readiness probe so they
+// do not trigger restarts.
+func (h *Handler) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Status{Status: StatusOK})
+}
+
+// Readiness handles GET /readyz requests by probing every dependency
+func (h *Handler) Readiness(w http.ResponseWriter, r *http.Request) {
+	status := Status{
+		Status:     StatusOK,
+		Components: make(map[string]*Component, len(h.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check DependencyCheck) {
+			defer wg.Done()
+			component := runCheck(r.Context(), check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			status.Components[check.Name] = component
+			if component.Status == StatusOK {
+				return
+			}
+			if check.Critical {
+				status.Status = StatusUnavailable
+			} else if status.Status == StatusOK {
+				status.Status = StatusDegraded
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	if h.draining.Load() {
+		status.Status = StatusUnavailable
+		status.Draining = true
+	}
+
+	code := http.StatusOK
+	if status.Status == StatusUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+func runCheck(ctx context.Context, check DependencyCheck) *Component {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	component := &Component{
+		Status:    StatusOK,
+		Critical:  check.Critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		component.Status = StatusUnavailable
+		component.Error = err.Error()
+	}
+	return component
+}
@@ -0,0 +1,93 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func probe(t *testing.T, handler http.HandlerFunc) (int, Status) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var status Status
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, status
+}
+
+func check(name string, critical bool, err error) DependencyCheck {
+	return DependencyCheck{Name: name, Critical: critical, Check: func(ctx context.Context) error { return err }}
+}
+
+func TestReadiness(t *testing.T) {
+	down := errors.New("connection refused")
+	tests := []struct {
+		name       string
+		checks     []DependencyCheck
+		wantCode   int
+		wantStatus string
+	}{
+		{"no dependencies", nil, http.StatusOK, StatusOK},
+		{"all up", []DependencyCheck{check("storage", true, nil), check("analytics", false, nil)}, http.StatusOK, StatusOK},
+		{"optional dependency down", []DependencyCheck{check("storage", true, nil), check("analytics", false, down)}, http.StatusOK, StatusDegraded},
+		{"critical dependency down", []DependencyCheck{check("storage", true, down), check("analytics", false, nil)}, http.StatusServiceUnavailable, StatusUnavailable},
+		{"both down", []DependencyCheck{check("storage", true, down), check("analytics", false, down)}, http.StatusServiceUnavailable, StatusUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(tt.checks...)
+			code, status := probe(t, h.Readiness)
+			if code != tt.wantCode || status.Status != tt.wantStatus {
+				t.Errorf("readiness = %d %s, want %d %s", code, status.Status, tt.wantCode, tt.wantStatus)
+			}
+			for _, c := range tt.checks {
+				component := status.Components[c.Name]
+				if component == nil {
+					t.Fatalf("component %s missing", c.Name)
+				}
+				failed := c.Check(context.Background()) != nil
+				if (component.Status == StatusUnavailable) != failed || (component.Error != "") != failed {
+					t.Errorf("component %s = %+v", c.Name, component)
+				}
+			}
+
+			// Liveness never depends on the dependencies
+			if code, status := probe(t, h.Liveness); code != http.StatusOK || status.Status != StatusOK {
+				t.Errorf("liveness = %d %s, want 200 ok", code, status.Status)
+			}
+		})
+	}
+}
+
+func TestReadinessWhileDraining(t *testing.T) {
+	h := NewHandler(check("storage", true, nil))
+	if code, _ := probe(t, h.Readiness); code != http.StatusOK {
+		t.Fatalf("readiness before shutdown = %d", code)
+	}
+
+	h.SetDraining()
+	code, status := probe(t, h.Readiness)
+	if code != http.StatusServiceUnavailable || status.Status != StatusUnavailable || !status.Draining {
+		t.Errorf("readiness while draining = %d %+v, want 503 draining", code, status)
+	}
+	if code, _ := probe(t, h.Liveness); code != http.StatusOK {
+		t.Errorf("liveness while draining = %d, want 200", code)
+	}
+}
+
+func TestReadinessCheckTimeout(t *testing.T) {
+	h := NewHandler(DependencyCheck{Name: "storage", Critical: true, Check: func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("check run without a deadline")
+		}
+		return nil
+	}})
+	if code, status := probe(t, h.Readiness); code != http.StatusOK {
+		t.Errorf("readiness = %d %+v", code, status.Components["storage"])
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"linkshort/pkg/logging"
+)
+
+// namespace prefixes every metric name, as in the services
+const namespace = "linkshort"
+
+// unmatchedRoute labels requests no route matched, so 404s and 405s for
+// arbitrary paths cannot grow the label set
+const unmatchedRoute = "unmatched"
+
+type contextKey struct{}
+
+var routeKey contextKey
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+// Handler serves the registered metrics for Prometheus scraping
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// NewServer serves /metrics on its own listener at addr, so scraping is only
+// reachable where that port is, never through the public router
+func NewServer(addr string) *http.Server {
+	routes := http.NewServeMux()
+	routes.Handle("GET /metrics", Handler())
+	return &http.Server{Addr: addr, Handler: routes, ReadHeaderTimeout: 5 * time.Second}
+}
+
+// Instrument records request counts and latency per route template for
+// everything router serves. It wraps the router rather than relying on
+// mux.Router.Use alone, since mux runs no middleware for requests that match
+// no route or no method; those are labelled "unmatched".
+func Instrument(router *mux.Router) http.Handler {
+	router.Use(routeTemplate)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		start := time.Now()
+		recorder := &logging.ResponseRecorder{ResponseWriter: w, Status: http.StatusOK}
+		router.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), routeKey, &route)))
+
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.Status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routeTemplate fills in the route Instrument labels a matched request with
+func routeTemplate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeKey).(*string); ok {
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					*route = template
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewServerServesOnlyMetrics(t *testing.T) {
+	httpRequests.WithLabelValues("/ping", "GET", "200").Add(0)
+	handler := NewServer(":0").Handler
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "linkshort_http_requests_total") {
+		t.Fatalf("GET /metrics = %d, want linkshort metrics", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/abc123", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /abc123 = %d, want 404", w.Code)
+	}
+}
+
+func TestInstrumentLabelsRoutes(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}).Methods("POST")
+	handler := Instrument(router)
+
+	tests := []struct {
+		method, target string
+		route, status  string
+	}{
+		{"POST", "/items/1", "/items/{id}", "201"},
+		{"GET", "/items/1", unmatchedRoute, "405"},
+		{"GET", "/nowhere/at/all", unmatchedRoute, "404"},
+	}
+
+	for _, tt := range tests {
+		counter := httpRequests.WithLabelValues(tt.route, tt.method, tt.status)
+		before := testutil.ToFloat64(counter)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("%s %s: counted %v times as route %q status %s, want once",
+				tt.method, tt.target, got, tt.route, tt.status)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig describes which cross-origin browser requests are allowed
+type CORSConfig struct {
+	// AllowedOrigins may read from the API; "*" allows any origin
+	AllowedOrigins []string
+	// WriteOrigins may call mutating methods. A wildcard is never honoured
+	// here, so writes always need an explicitly listed origin.
+	WriteOrigins     []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORSConfigFromEnv reads the policy from CORS_ALLOWED_ORIGINS,
+// CORS_WRITE_ORIGINS, CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS,
+// CORS_EXPOSED_HEADERS, CORS_ALLOW_CREDENTIALS and CORS_MAX_AGE
+func CORSConfigFromEnv() CORSConfig {
+	cfg := CORSConfig{
+		AllowedOrigins: envList("CORS_ALLOWED_ORIGINS", []string{"*"}),
+		AllowedMethods: envList("CORS_ALLOWED_METHODS", []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}),
+		AllowedHeaders: envList("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID", "X-Workspace"}),
+		ExposedHeaders: envList("CORS_EXPOSED_HEADERS", []string{"X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"}),
+		MaxAge:         10 * time.Minute,
+	}
+
+	// Origins trusted to read are trusted to write unless configured otherwise
+	cfg.WriteOrigins = envList("CORS_WRITE_ORIGINS", cfg.AllowedOrigins)
+
+	cfg.AllowCredentials, _ = strconv.ParseBool(os.Getenv("CORS_ALLOW_CREDENTIALS"))
+	if maxAge, err := time.ParseDuration(os.Getenv("CORS_MAX_AGE")); err == nil {
+		cfg.MaxAge = maxAge
+	}
+
+	return cfg
+}
+
+func envList(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// CORS applies a cross-origin policy to every request
+type CORS struct {
+	cfg          CORSConfig
+	readAny      bool
+	readOrigins  map[string]bool
+	writeOrigins map[string]bool
+	writeMethods string
+	readMethods  string
+	headers      string
+	exposed      string
+	maxAge       string
+}
+
+// NewCORS builds the middleware for a policy
+func NewCORS(cfg CORSConfig) *CORS {
+	c := &CORS{
+		cfg:          cfg,
+		readOrigins:  make(map[string]bool),
+		writeOrigins: make(map[string]bool),
+		headers:      strings.Join(cfg.AllowedHeaders, ", "),
+		exposed:      strings.Join(cfg.ExposedHeaders, ", "),
+		maxAge:       strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			c.readAny = true
+			continue
+		}
+		c.readOrigins[strings.ToLower(origin)] = true
+	}
+	for _, origin := range cfg.WriteOrigins {
+		if origin != "*" {
+			c.writeOrigins[strings.ToLower(origin)] = true
+		}
+	}
+
+	var safe []string
+	for _, method := range cfg.AllowedMethods {
+		if isSafeMethod(method) {
+			safe = append(safe, method)
+		}
+	}
+	c.readMethods = strings.Join(append(safe, http.MethodOptions), ", ")
+	c.writeMethods = strings.Join(append(cfg.AllowedMethods, http.MethodOptions), ", ")
+
+	return c
+}
+
+func isSafeMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// sameOrigin reports whether origin names the host the request was sent
+// to. The scheme is not compared because TLS usually ends at the proxy.
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+func (c *CORS) canRead(origin string) bool {
+	return c.readAny || c.readOrigins[strings.ToLower(origin)] || c.canWrite(origin)
+}
+
+func (c *CORS) canWrite(origin string) bool {
+	return c.writeOrigins[strings.ToLower(origin)]
+}
+
+// Handler wraps next with the CORS policy. Mutating requests that carry a
+// disallowed Origin are rejected outright rather than relying on the browser,
+// because simple form posts are sent without a preflight.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		preflight := r.Method == http.MethodOptions && requestMethod != ""
+
+		if origin == "" || sameOrigin(r, origin) {
+			// Not a browser cross-origin request. Browsers also send Origin
+			// on same-origin form posts, such as the unlock page of a
+			// protected link served from a short domain.
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Method
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			method = requestMethod
+		}
+
+		allowed := c.canRead(origin)
+		if !isSafeMethod(method) {
+			allowed = c.canWrite(origin)
+		}
+
+		if !allowed {
+			if preflight || r.Method == http.MethodOptions {
+				// Answer without CORS headers so the browser blocks the request
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if !isSafeMethod(r.Method) {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.readAny && isSafeMethod(method) && !c.cfg.AllowCredentials && !c.canWrite(origin) {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.cfg.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if c.exposed != "" {
+			header.Set("Access-Control-Expose-Headers", c.exposed)
+		}
+
+		if r.Method == http.MethodOptions {
+			if c.canWrite(origin) {
+				header.Set("Access-Control-Allow-Methods", c.writeMethods)
+			} else {
+				header.Set("Access-Control-Allow-Methods", c.readMethods)
+			}
+			header.Set("Access-Control-Allow-Headers", c.headers)
+			header.Set("Access-Control-Max-Age", c.maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
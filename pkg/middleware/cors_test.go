@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCORS() *CORS {
+	return NewCORS(CORSConfig{
+		AllowedOrigins: []string{"*"},
+		WriteOrigins:   []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "HEAD", "POST", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "X-API-Key"},
+		MaxAge:         time.Minute,
+	})
+}
+
+func serve(c *CORS, r *http.Request) (*httptest.ResponseRecorder, bool) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	w := httptest.NewRecorder()
+	c.Handler(next).ServeHTTP(w, r)
+	return w, called
+}
+
+func TestCORSWriteOrigins(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		host       string
+		origin     string
+		wantCalled bool
+		wantCode   int
+		wantAllow  string
+	}{
+		{"no origin", http.MethodPost, "api.example.com", "", true, http.StatusOK, ""},
+		{"listed write origin", http.MethodPost, "api.example.com", "https://app.example.com", true, http.StatusOK, "https://app.example.com"},
+		{"unlisted write origin", http.MethodPost, "api.example.com", "https://evil.example", false, http.StatusForbidden, ""},
+		{"wildcard read", http.MethodGet, "api.example.com", "https://evil.example", true, http.StatusOK, "*"},
+		// The unlock form of a protected link posts back to the short
+		// domain it was served from, which is not a configured origin
+		{"same-origin unlock form", http.MethodPost, "sho.rt", "https://sho.rt", true, http.StatusOK, ""},
+		{"same-origin with port", http.MethodPost, "localhost:8080", "http://localhost:8080", true, http.StatusOK, ""},
+		{"origin on another port", http.MethodPost, "localhost:8080", "http://localhost:3000", false, http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://"+tt.host+"/abc123/unlock", strings.NewReader("password=x"))
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w, called := serve(testCORS(), r)
+			if called != tt.wantCalled {
+				t.Errorf("next called = %v, want %v", called, tt.wantCalled)
+			}
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name        string
+		origin      string
+		method      string
+		wantMethods string
+	}{
+		{"write origin", "https://app.example.com", http.MethodDelete, "GET, HEAD, POST, DELETE, OPTIONS"},
+		{"read-only origin asking to read", "https://other.example", http.MethodGet, "GET, HEAD, OPTIONS"},
+		{"read-only origin asking to write", "https://other.example", http.MethodDelete, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodOptions, "http://api.example.com/urls/abc", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", tt.method)
+			w, called := serve(testCORS(), r)
+			if called {
+				t.Error("preflight reached the handler")
+			}
+			if w.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.wantMethods)
+			}
+		})
+	}
+}
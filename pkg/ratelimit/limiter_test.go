@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// limiters builds each Limiter with a clock the test advances
+var limiters = map[string]func(t *testing.T) (Limiter, func(time.Duration)){
+	"memory": func(t *testing.T) (Limiter, func(time.Duration)) {
+		l := NewMemoryLimiter()
+		now := time.Now()
+		l.now = func() time.Time { return now }
+		return l, func(d time.Duration) { now = now.Add(d) }
+	},
+	"redis": func(t *testing.T) (Limiter, func(time.Duration)) {
+		mr := miniredis.RunT(t)
+		now := time.Now()
+		mr.SetTime(now)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisLimiter(client), func(d time.Duration) {
+			now = now.Add(d)
+			mr.SetTime(now)
+		}
+	},
+}
+
+func TestTokenBucket(t *testing.T) {
+	rule := Rule{Rate: 2, Burst: 3}
+	for name, newLimiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			l, advance := newLimiter(t)
+			ctx := context.Background()
+
+			for i := range rule.Burst {
+				result, err := l.Allow(ctx, "bucket", rule)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.Allowed || result.Remaining != rule.Burst-1-i {
+					t.Fatalf("request %d = %+v, want allowed with %d remaining", i, result, rule.Burst-1-i)
+				}
+			}
+
+			result, err := l.Allow(ctx, "bucket", rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed {
+				t.Fatal("request past the burst was allowed")
+			}
+			if result.RetryAfter <= 0 || result.RetryAfter > time.Second/2 {
+				t.Errorf("RetryAfter = %v, want up to 500ms", result.RetryAfter)
+			}
+
+			if other, _ := l.Allow(ctx, "other", rule); !other.Allowed {
+				t.Error("an empty bucket limited another key")
+			}
+
+			advance(time.Second / 2)
+			if result, _ := l.Allow(ctx, "bucket", rule); !result.Allowed {
+				t.Error("bucket did not refill")
+			}
+		})
+	}
+}
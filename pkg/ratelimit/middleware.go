@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"linkshort/pkg/apikey"
+	"linkshort/pkg/middleware"
+)
+
+// Policy holds the limits for one class of endpoints. Requests carrying a
+// known API key are limited per key, everything else per client IP.
+type Policy struct {
+	Anonymous Rule
+	Keyed     Rule
+}
+
+// Config is the rate limiting setup read from the environment
+type Config struct {
+	Enabled  bool
+	Policies map[string]Policy
+	// APIKeys are the keys that get their own buckets; unknown keys are
+	// treated as anonymous so they cannot be rotated to dodge the IP limit
+	APIKeys []string
+}
+
+// ConfigFromEnv reads RATE_LIMIT_ENABLED, API_KEYS and, for every class in
+// defaults, RATE_LIMIT_<CLASS>_RPS, _BURST, _KEY_RPS and _KEY_BURST
+func ConfigFromEnv(defaults map[string]Policy) (Config, error) {
+	cfg := Config{Enabled: true, Policies: make(map[string]Policy, len(defaults))}
+
+	if value := os.Getenv("RATE_LIMIT_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_ENABLED %q", value)
+		}
+		cfg.Enabled = enabled
+	}
+
+	for _, key := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			cfg.APIKeys = append(cfg.APIKeys, key)
+		}
+	}
+
+	for class, policy := range defaults {
+		prefix := "RATE_LIMIT_" + strings.ToUpper(class)
+		var err error
+		if policy.Anonymous, err = envRule(prefix, policy.Anonymous); err != nil {
+			return cfg, err
+		}
+		if policy.Keyed, err = envRule(prefix+"_KEY", policy.Keyed); err != nil {
+			return cfg, err
+		}
+		cfg.Policies[class] = policy
+	}
+	return cfg, nil
+}
+
+func envRule(prefix string, rule Rule) (Rule, error) {
+	if value := os.Getenv(prefix + "_RPS"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+			return rule, fmt.Errorf("invalid %s_RPS %q", prefix, value)
+		}
+		rule.Rate = rate
+	}
+	if value := os.Getenv(prefix + "_BURST"); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil || burst < 1 {
+			return rule, fmt.Errorf("invalid %s_BURST %q", prefix, value)
+		}
+		rule.Burst = burst
+	}
+	return rule, nil
+}
+
+// RateLimiter applies per-class policies to HTTP handlers
+type RateLimiter struct {
+	limiter  Limiter
+	policies map[string]Policy
+	apiKeys  map[string]string
+}
+
+// New creates the middleware for a limiter and configuration
+func New(limiter Limiter, cfg Config) *RateLimiter {
+	rl := &RateLimiter{
+		limiter:  limiter,
+		policies: cfg.Policies,
+		apiKeys:  make(map[string]string, len(cfg.APIKeys)),
+	}
+	for _, key := range cfg.APIKeys {
+		// Buckets are named after a digest so keys never appear in Redis
+		rl.apiKeys[key] = apikey.Digest(key)
+	}
+	return rl
+}
+
+// Limit wraps next with the policy for class. Every response carries
+// RateLimit-* headers; rejected requests get 429 with Retry-After. If the
+// limiter itself fails the request is let through rather than taking the
+// endpoint down with it. A nil RateLimiter leaves next unlimited.
+func (rl *RateLimiter) Limit(class string, next http.HandlerFunc) http.Handler {
+	if rl == nil {
+		return next
+	}
+	policy, ok := rl.policies[class]
+	if !ok {
+		panic("ratelimit: no policy for class " + class)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rule := policy.Anonymous
+		identity := "ip:" + middleware.ClientIP(r)
+		if digest, ok := rl.apiKeys[apikey.FromRequest(r)]; ok {
+			rule = policy.Keyed
+			identity = "key:" + digest
+		}
+
+		result, err := rl.limiter.Allow(r.Context(), class+":"+identity, rule)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Rate limiter unavailable, allowing request",
+				"class", class, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset.Seconds())))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Burst, ceilSeconds(float64(rule.Burst)/rule.Rate)))
+
+		if !result.Allowed {
+			header.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimitBucketsByKey(t *testing.T) {
+	rl := New(NewMemoryLimiter(), Config{
+		Policies: map[string]Policy{
+			"create": {Anonymous: Rule{Rate: 0.001, Burst: 1}, Keyed: Rule{Rate: 0.001, Burst: 2}},
+		},
+		APIKeys: []string{"known-key", "admin-key"},
+	})
+	handler := rl.Limit("create", func(w http.ResponseWriter, r *http.Request) {})
+
+	send := func(header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/urls", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := send("", ""); w.Code != http.StatusOK {
+		t.Fatalf("anonymous request = %d", w.Code)
+	}
+	w := send("", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("second anonymous request = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	// Unknown keys share the IP's bucket, so rotating them gains nothing
+	if w := send("X-API-Key", "made-up"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("unknown key = %d, want 429", w.Code)
+	}
+
+	for _, header := range []string{"X-API-Key", "Authorization"} {
+		value := "admin-key"
+		if header == "Authorization" {
+			value = "Bearer admin-key"
+		}
+		if w := send(header, value); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("admin key via %s = %d, limit %q, want its own keyed bucket", header, w.Code, w.Header().Get("RateLimit-Limit"))
+		}
+	}
+	if w := send("X-API-Key", "known-key"); w.Code != http.StatusOK {
+		t.Errorf("other key = %d, want its own bucket", w.Code)
+	}
+}
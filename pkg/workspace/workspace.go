@@ -0,0 +1,155 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+
+	"linkshort/pkg/apikey"
+)
+
+// Default is the ID of the default workspace. It holds the links and clicks
+// of anonymous callers, the admin and keys from API_KEYS, and everything
+// stored before workspaces existed, under unprefixed storage keys.
+const Default = ""
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Workspace is a team sharing the deployment. It owns its links, API keys,
+// domains and analytics, which other workspaces cannot see. Both services
+// read the same WORKSPACES_FILE; the URL service enforces the quotas.
+type Workspace struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// APIKeys authenticate the workspace's members
+	APIKeys []string `json:"api_keys"`
+	// MaxLinks bounds how many links the workspace may create; 0 means
+	// unlimited
+	MaxLinks int `json:"max_links,omitempty"`
+	// MaxMonthlyClicks bounds the redirects of all its links per calendar
+	// month (UTC); 0 means unlimited
+	MaxMonthlyClicks int `json:"max_monthly_clicks,omitempty"`
+}
+
+// Registry holds the configured workspaces
+type Registry struct {
+	workspaces map[string]*Workspace
+}
+
+// NewRegistry validates workspaces and indexes them by ID
+func NewRegistry(workspaces []Workspace) (*Registry, error) {
+	r := &Registry{workspaces: make(map[string]*Workspace, len(workspaces))}
+	keys := make(map[string]bool)
+	for i := range workspaces {
+		ws := &workspaces[i]
+		if !idPattern.MatchString(ws.ID) {
+			return nil, fmt.Errorf("workspace id %q must be 1-32 lower-case letters, digits or dashes", ws.ID)
+		}
+		if _, exists := r.workspaces[ws.ID]; exists {
+			return nil, fmt.Errorf("duplicate workspace id %q", ws.ID)
+		}
+		if ws.MaxLinks < 0 || ws.MaxMonthlyClicks < 0 {
+			return nil, fmt.Errorf("workspace %q: quotas must not be negative", ws.ID)
+		}
+		for _, key := range ws.APIKeys {
+			if key == "" || keys[key] {
+				return nil, fmt.Errorf("workspace %q: API keys must be non-empty and unique", ws.ID)
+			}
+			keys[key] = true
+		}
+		r.workspaces[ws.ID] = ws
+	}
+	return r, nil
+}
+
+// RegistryFromEnv loads the workspaces listed in the JSON file named by
+// WORKSPACES_FILE. Without it only the default workspace exists.
+func RegistryFromEnv() (*Registry, error) {
+	path := os.Getenv("WORKSPACES_FILE")
+	if path == "" {
+		return NewRegistry(nil)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var workspaces []Workspace
+	if err := json.Unmarshal(data, &workspaces); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return NewRegistry(workspaces)
+}
+
+// Find returns a configured workspace; the default workspace has no entry
+// and no quotas
+func (r *Registry) Find(id string) (*Workspace, bool) {
+	if id == Default {
+		return &Workspace{ID: Default}, true
+	}
+	ws, ok := r.workspaces[id]
+	return ws, ok
+}
+
+// IDs returns the default workspace followed by every configured one, in
+// order
+func (r *Registry) IDs() []string {
+	ids := make([]string, 0, len(r.workspaces)+1)
+	for id := range r.workspaces {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return append([]string{Default}, ids...)
+}
+
+// Keys maps every workspace API key to its workspace ID
+func (r *Registry) Keys() map[string]string {
+	keys := make(map[string]string)
+	for id, ws := range r.workspaces {
+		for _, key := range ws.APIKeys {
+			keys[key] = id
+		}
+	}
+	return keys
+}
+
+type contextKey struct{}
+
+// NewContext returns a context acting within workspace id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the workspace a context acts within, the default one
+// unless NewContext said otherwise
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// KeyPrefix returns what storage keys of workspace id start with: nothing
+// for the default workspace, "ws:<id>:" otherwise
+func KeyPrefix(id string) string {
+	if id == Default {
+		return ""
+	}
+	return "ws:" + id + ":"
+}
+
+// Scoped prefixes key with the prefix of the workspace ctx acts within
+func Scoped(ctx context.Context, key string) string {
+	return KeyPrefix(FromContext(ctx)) + key
+}
+
+// Identify stores the workspace of the request's API key in its context.
+// Requests without a workspace key act within the default workspace.
+func (r *Registry) Identify(next http.Handler) http.Handler {
+	keys := r.Keys()
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := NewContext(req.Context(), keys[apikey.FromRequest(req)])
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
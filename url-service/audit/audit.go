@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"linkshort/pkg/logging"
+	"linkshort/pkg/workspace"
+
+	"url-service/auth"
+	"url-service/models"
+	"url-service/storage"
+)
+
+// Logger records mutations in the audit log. Entries are recorded once the
+// mutation is stored; a failure to record one is returned, and handlers then
+// fail the request with 500 rather than report an unaudited change as done.
+type Logger struct {
+	store storage.AuditStorage
+}
+
+// NewLogger creates a logger writing to store
+func NewLogger(store storage.AuditStorage) *Logger {
+	return &Logger{store: store}
+}
+
+// Entry describes a mutation to record
+type Entry struct {
+	Action string
+	// ShortCode is the link's key, see models.LinkKey
+	ShortCode string
+	Domain    string
+	ReportID  string
+	// Before and After are the changed object's state, nil when it did
+	// not exist
+	Before any
+	After  any
+}
+
+// Record appends e with the actor, workspace, client IP and request ID from
+// ctx
+func (l *Logger) Record(ctx context.Context, e Entry) error {
+	principal := auth.PrincipalFromContext(ctx)
+	entry := &models.AuditEntry{
+		ID:        newID(),
+		Timestamp: time.Now().UTC(),
+		Actor:     principal.Actor,
+		Action:    e.Action,
+		Workspace: workspace.FromContext(ctx),
+		ShortCode: e.ShortCode,
+		Domain:    e.Domain,
+		ReportID:  e.ReportID,
+		Before:    marshal(e.Before),
+		After:     marshal(e.After),
+		IP:        principal.IP,
+		RequestID: logging.RequestIDFromContext(ctx),
+	}
+
+	if err := l.store.AppendAudit(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit entry",
+			"action", entry.Action, "actor", entry.Actor, "short_code", entry.ShortCode, "error", err)
+		return err
+	}
+	return nil
+}
+
+func marshal(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	if url, ok := v.(*models.URL); ok && url != nil {
+		v = url.Redacted()
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"linkshort/pkg/apikey"
+	"linkshort/pkg/middleware"
+	"linkshort/pkg/workspace"
+)
+
+// Actors that are not derived from an API key
+const (
+	ActorAdmin     = "admin"
+	ActorAnonymous = "anonymous"
+	// ActorSystem marks changes the service makes on its own, such as
+	// disabling a link whose destination was flagged
+	ActorSystem = "system"
+)
+
+// WorkspaceHeader lets admin requests act within a workspace
+const WorkspaceHeader = "X-Workspace"
+
+// Principal identifies who sent a request
+type Principal struct {
+	// Actor is ActorAdmin, ActorAnonymous or "key:<digest>" for a key
+	// listed in API_KEYS or a workspace. Keys themselves are never recorded.
+	Actor string
+	IP    string
+}
+
+type contextKey struct{}
+
+// PrincipalFromContext returns the principal stored by Identify, or an
+// anonymous one
+func PrincipalFromContext(ctx context.Context) Principal {
+	if p, ok := ctx.Value(contextKey{}).(Principal); ok {
+		return p
+	}
+	return Principal{Actor: ActorAnonymous}
+}
+
+// WithActor returns a context whose principal acts as actor, keeping the IP
+func WithActor(ctx context.Context, actor string) context.Context {
+	p := PrincipalFromContext(ctx)
+	p.Actor = actor
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// Authenticator maps API keys to actors and workspaces
+type Authenticator struct {
+	adminKey   []byte
+	keys       map[string]string
+	workspaces *workspace.Registry
+	// keyWorkspaces maps the keys of configured workspaces to their IDs
+	keyWorkspaces map[string]string
+}
+
+// NewAuthenticator creates an authenticator for the admin key, client keys
+// of the default workspace and the keys of every configured workspace. With
+// an empty admin key every admin request is refused, so the admin endpoints
+// are off until a key is configured.
+func NewAuthenticator(adminKey string, apiKeys []string, workspaces *workspace.Registry) *Authenticator {
+	a := &Authenticator{
+		adminKey:      []byte(adminKey),
+		keys:          make(map[string]string, len(apiKeys)),
+		workspaces:    workspaces,
+		keyWorkspaces: workspaces.Keys(),
+	}
+	for _, key := range apiKeys {
+		a.keys[key] = "key:" + apikey.Digest(key)
+	}
+	for key := range a.keyWorkspaces {
+		a.keys[key] = "key:" + apikey.Digest(key)
+	}
+	return a
+}
+
+// AuthenticatorFromEnv reads ADMIN_API_KEY and the comma-separated API_KEYS
+func AuthenticatorFromEnv(workspaces *workspace.Registry) *Authenticator {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return NewAuthenticator(os.Getenv("ADMIN_API_KEY"), keys, workspaces)
+}
+
+func (a *Authenticator) isAdmin(key string) bool {
+	return len(a.adminKey) > 0 && subtle.ConstantTimeCompare([]byte(key), a.adminKey) == 1
+}
+
+// Identify stores the request's principal and workspace in its context.
+// Workspace keys act within their workspace; the admin acts within the one
+// named by WorkspaceHeader, and everyone else within the default workspace.
+// Unknown keys are treated as anonymous rather than rejected.
+func (a *Authenticator) Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := Principal{Actor: ActorAnonymous, IP: middleware.ClientIP(r)}
+		ws := workspace.Default
+		if key := apikey.FromRequest(r); key != "" {
+			if a.isAdmin(key) {
+				p.Actor = ActorAdmin
+				ws = r.Header.Get(WorkspaceHeader)
+				if _, ok := a.workspaces.Find(ws); !ok {
+					http.Error(w, "Unknown workspace", http.StatusBadRequest)
+					return
+				}
+			} else if actor, ok := a.keys[key]; ok {
+				p.Actor = actor
+				ws = a.keyWorkspaces[key]
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), contextKey{}, p)
+		ctx = workspace.NewContext(ctx, ws)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireAdmin wraps next so it only runs for requests carrying the admin key
+func (a *Authenticator) RequireAdmin(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(a.adminKey) == 0 {
+			http.Error(w, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+		if !a.isAdmin(apikey.FromRequest(r)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
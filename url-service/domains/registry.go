@@ -0,0 +1,184 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"url-service/models"
+	"url-service/storage"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidHost is returned for host names that cannot be registered
+var ErrInvalidHost = errors.New("invalid domain host")
+
+// Options configures a Registry
+type Options struct {
+	// RefreshInterval is how often the registry is reloaded from storage,
+	// picking up domains registered or removed through other replicas
+	RefreshInterval time.Duration
+}
+
+// OptionsFromEnv reads DOMAIN_REFRESH_INTERVAL (30s)
+func OptionsFromEnv() (Options, error) {
+	opts := Options{RefreshInterval: 30 * time.Second}
+	if value := os.Getenv("DOMAIN_REFRESH_INTERVAL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("invalid DOMAIN_REFRESH_INTERVAL %q", value)
+		}
+		opts.RefreshInterval = d
+	}
+	return opts, nil
+}
+
+// Registry answers which registered domain a request's host belongs to.
+// Redirects consult it on every request, so it keeps the domains in memory
+// rather than asking storage each time.
+type Registry struct {
+	store storage.DomainStorage
+
+	mu      sync.RWMutex
+	domains map[string]*models.Domain
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewRegistry loads the registered domains from store and keeps them fresh
+// until Close is called
+func NewRegistry(store storage.DomainStorage, opts Options) (*Registry, error) {
+	r := &Registry{
+		store: store,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if err := r.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	go r.refreshLoop(opts.RefreshInterval)
+	return r, nil
+}
+
+// Reload replaces the in-memory registry with the domains in storage
+func (r *Registry) Reload(ctx context.Context) error {
+	list, err := r.store.FindDomains(ctx)
+	if err != nil {
+		return err
+	}
+	domains := make(map[string]*models.Domain, len(list))
+	for _, domain := range list {
+		domains[domain.Host] = domain
+	}
+
+	r.mu.Lock()
+	r.domains = domains
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Registry) refreshLoop(interval time.Duration) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Reload(context.Background()); err != nil {
+				slog.Warn("Domain registry reload failed", "error", err)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Lookup returns the registered domain serving host, which may carry a
+// port as in a Host header
+func (r *Registry) Lookup(host string) (*models.Domain, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	domain, ok := r.domains[host]
+	return domain, ok
+}
+
+// Owned returns the domains of a workspace, ordered by host
+func (r *Registry) Owned(workspace string) []*models.Domain {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var owned []*models.Domain
+	for _, domain := range r.domains {
+		if domain.Workspace == workspace {
+			owned = append(owned, domain)
+		}
+	}
+	slices.SortFunc(owned, func(a, b *models.Domain) int {
+		return strings.Compare(a.Host, b.Host)
+	})
+	return owned
+}
+
+// List returns every registered domain, ordered by host
+func (r *Registry) List(ctx context.Context) ([]*models.Domain, error) {
+	return r.store.FindDomains(ctx)
+}
+
+// Add registers a domain
+func (r *Registry) Add(ctx context.Context, domain *models.Domain) error {
+	if err := r.store.SaveDomain(ctx, domain); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.domains[domain.Host] = domain
+	r.mu.Unlock()
+	return nil
+}
+
+// Remove unregisters a domain
+func (r *Registry) Remove(ctx context.Context, host string) error {
+	if err := r.store.DeleteDomain(ctx, host); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	delete(r.domains, host)
+	r.mu.Unlock()
+	return nil
+}
+
+// Close stops refreshing the registry
+func (r *Registry) Close() error {
+	close(r.stop)
+	<-r.done
+	return nil
+}
+
+// NormalizeHost returns a domain host name in the form the registry keys it
+// by: lower case, without a trailing dot, internationalized names in
+// punycode
+func NormalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" || strings.ContainsAny(host, ":/?#@ ") || !strings.Contains(host, ".") {
+		return "", ErrInvalidHost
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", ErrInvalidHost
+	}
+	return ascii, nil
+}
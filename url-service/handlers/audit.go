@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+	"url-service/storage"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// AuditHandler serves the audit log
+type AuditHandler struct {
+	storage storage.AuditStorage
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(s storage.AuditStorage) *AuditHandler {
+	return &AuditHandler{storage: s}
+}
+
+// GetAudit handles GET /audit?short_code=&domain=&actor=&from=&to=&before=&limit=
+// requests, answering newest first. from and to are RFC 3339 timestamps;
+// before takes the cursor of the last entry of the previous page. Only
+// entries of the workspace the admin acts within are returned.
+func (h *AuditHandler) GetAudit(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := models.AuditQuery{
+		Workspace: workspace.FromContext(r.Context()),
+		ShortCode: params.Get("short_code"),
+		Actor:     params.Get("actor"),
+		Before:    params.Get("before"),
+		Limit:     defaultAuditPageSize,
+	}
+	if query.ShortCode != "" {
+		query.ShortCode = models.LinkKey(queryDomain(r), query.ShortCode)
+	}
+
+	var err error
+	if query.From, err = parseTime(params.Get("from")); err != nil {
+		http.Error(w, "Invalid from: expected an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	if query.To, err = parseTime(params.Get("to")); err != nil {
+		http.Error(w, "Invalid to: expected an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxAuditPageSize {
+			http.Error(w, "Invalid limit: expected 1 to "+strconv.Itoa(maxAuditPageSize), http.StatusBadRequest)
+			return
+		}
+		query.Limit = n
+	}
+
+	entries, err := h.storage.FindAudit(r.Context(), query)
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		http.Error(w, "Invalid before: expected a cursor from an earlier page", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
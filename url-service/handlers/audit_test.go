@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"url-service/audit"
+	"url-service/models"
+)
+
+// failingAudit is an audit store that cannot be written
+type failingAudit struct{}
+
+func (failingAudit) AppendAudit(ctx context.Context, entry *models.AuditEntry) error {
+	return errors.New("audit store unavailable")
+}
+
+func (failingAudit) FindAudit(ctx context.Context, query models.AuditQuery) ([]*models.AuditEntry, error) {
+	return nil, nil
+}
+
+func TestMutationsFailWithoutAuditTrail(t *testing.T) {
+	h, store := newTestHandler(t)
+	h.audit = audit.NewLogger(failingAudit{})
+	ctx := adminContext()
+
+	r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url":"https://example.org/page"}`)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	h.CreateShortURL(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("create status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+	}
+
+	if err := store.Save(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	current, err := store.FindByShortCode(ctx, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := *current
+	updated.OriginalURL = "https://example.org"
+	r = httptest.NewRequest(http.MethodPut, "/urls/abc123", nil).WithContext(ctx)
+	w = httptest.NewRecorder()
+	h.saveVersion(w, r, current, &updated, models.AuditURLUpdate, 0)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("update status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	if _, err := setStatus(ctx, store, h.audit, "abc123", models.URLStatusDisabled, "spam"); err == nil {
+		t.Error("setStatus succeeded without recording the change")
+	}
+}
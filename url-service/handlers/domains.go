@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"time"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/audit"
+	"url-service/domains"
+	"url-service/models"
+	"url-service/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// DomainHandler manages the registry of branded short domains
+type DomainHandler struct {
+	registry   *domains.Registry
+	storage    storage.URLStorage
+	workspaces *workspace.Registry
+	audit      *audit.Logger
+	// defaultHost serves links created without a domain and cannot be
+	// registered
+	defaultHost string
+}
+
+// NewDomainHandler creates a new domain handler
+func NewDomainHandler(registry *domains.Registry, s storage.URLStorage, workspaces *workspace.Registry, auditLog *audit.Logger) *DomainHandler {
+	return &DomainHandler{
+		registry:    registry,
+		storage:     s,
+		workspaces:  workspaces,
+		audit:       auditLog,
+		defaultHost: publicShortURLHost(),
+	}
+}
+
+// ListDomains handles GET /admin/domains requests
+func (h *DomainHandler) ListDomains(w http.ResponseWriter, r *http.Request) {
+	list, err := h.registry.List(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve domains", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// CreateDomain handles POST /admin/domains requests. The domain is given to
+// the workspace named in the body, not the one the admin acts within.
+func (h *DomainHandler) CreateDomain(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	host, err := domains.NormalizeHost(req.Host)
+	if err != nil {
+		http.Error(w, "host must be a domain name without scheme, port or path", http.StatusBadRequest)
+		return
+	}
+	if host == h.defaultHost {
+		http.Error(w, "host is the default short domain", http.StatusBadRequest)
+		return
+	}
+	if _, exists := h.registry.Lookup(host); exists {
+		http.Error(w, "Domain already registered", http.StatusConflict)
+		return
+	}
+
+	scheme := req.Scheme
+	switch scheme {
+	case "":
+		scheme = "https"
+	case "http", "https":
+	default:
+		http.Error(w, "scheme must be http or https", http.StatusBadRequest)
+		return
+	}
+	if _, ok := h.workspaces.Find(req.Workspace); !ok {
+		http.Error(w, fmt.Sprintf("Unknown workspace %q", req.Workspace), http.StatusBadRequest)
+		return
+	}
+
+	domain := &models.Domain{Host: host, Scheme: scheme, Workspace: req.Workspace, CreatedAt: time.Now()}
+	if err := h.registry.Add(r.Context(), domain); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save domain", "domain", host, "error", err)
+		http.Error(w, "Failed to save domain", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Domain registered", "domain", host, "workspace", domain.Workspace)
+	if err := h.audit.Record(domainContext(r.Context(), domain), audit.Entry{Action: models.AuditDomainCreate, Domain: host, After: domain}); err != nil {
+		http.Error(w, "Failed to record audit entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(domain)
+}
+
+// DeleteDomain handles DELETE /admin/domains/{host} requests. Domains with
+// links cannot be removed: their host would fall back to the default
+// domain and serve its links under the same codes.
+func (h *DomainHandler) DeleteDomain(w http.ResponseWriter, r *http.Request) {
+	domain, ok := h.registry.Lookup(mux.Vars(r)["host"])
+	if !ok {
+		http.Error(w, "Domain not found", http.StatusNotFound)
+		return
+	}
+
+	urls, err := h.storage.FindAll(domainContext(r.Context(), domain))
+	if err != nil {
+		http.Error(w, "Failed to retrieve URLs", http.StatusInternalServerError)
+		return
+	}
+	for _, url := range urls {
+		if url.Domain == domain.Host {
+			http.Error(w, "Domain still has links", http.StatusConflict)
+			return
+		}
+	}
+
+	err = h.registry.Remove(r.Context(), domain.Host)
+	if errors.Is(err, storage.ErrDomainNotFound) {
+		http.Error(w, "Domain not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to delete domain", "domain", domain.Host, "error", err)
+		http.Error(w, "Failed to delete domain", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Domain removed", "domain", domain.Host)
+	if err := h.audit.Record(domainContext(r.Context(), domain), audit.Entry{Action: models.AuditDomainDelete, Domain: domain.Host, Before: domain}); err != nil {
+		http.Error(w, "Failed to record audit entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// domainContext returns ctx acting within the workspace owning domain
+func domainContext(ctx context.Context, domain *models.Domain) context.Context {
+	return workspace.NewContext(ctx, domain.Workspace)
+}
+
+// hostRequest resolves a short code requested through the request's Host:
+// registered domains serve their own workspace's links, every other host
+// the default domain's. It returns the request acting within that
+// workspace, whoever sent it, and the link's storage key.
+func (h *URLHandler) hostRequest(r *http.Request, shortCode string) (*http.Request, string) {
+	domain, ok := h.domains.Lookup(r.Host)
+	if !ok {
+		return r.WithContext(workspace.NewContext(r.Context(), workspace.Default)), shortCode
+	}
+	return r.WithContext(domainContext(r.Context(), domain)), models.LinkKey(domain.Host, shortCode)
+}
+
+// queryKey returns the storage key of the link named in an API path, on the
+// domain given by the domain query parameter
+func queryKey(r *http.Request) string {
+	return models.LinkKey(queryDomain(r), mux.Vars(r)["shortCode"])
+}
+
+// queryDomain returns the normalized domain query parameter, empty for the
+// default domain
+func queryDomain(r *http.Request) string {
+	value := r.URL.Query().Get("domain")
+	if value == "" {
+		return ""
+	}
+	if host, err := domains.NormalizeHost(value); err == nil {
+		return host
+	}
+	// Unknown to the registry either way, so lookups simply miss
+	return value
+}
+
+// resolveDomain checks the domain of a create request, answering the request
+// itself when it is not registered to the caller's workspace. Links of other
+// workspaces than the default one are only reachable through their own
+// domains, so they must name one unless the workspace has exactly one.
+func (h *URLHandler) resolveDomain(w http.ResponseWriter, r *http.Request, value string) (*models.Domain, bool) {
+	ws := workspace.FromContext(r.Context())
+	if value == "" {
+		if ws == workspace.Default {
+			return nil, true
+		}
+		if owned := h.domains.Owned(ws); len(owned) == 1 {
+			return owned[0], true
+		}
+		http.Error(w, "domain is required: the workspace's links live on its own domains", http.StatusBadRequest)
+		return nil, false
+	}
+	host, err := domains.NormalizeHost(value)
+	if err == nil {
+		if domain, ok := h.domains.Lookup(host); ok && domain.Workspace == ws {
+			return domain, true
+		}
+	}
+	http.Error(w, fmt.Sprintf("Unknown domain %q", value), http.StatusBadRequest)
+	return nil, false
+}
+
+// shortURL builds the public URL of a link. The request's Host header is
+// client-controlled, so it is only used when PUBLIC_SHORT_URL_DOMAIN is not
+// configured.
+func (h *URLHandler) shortURL(r *http.Request, domain *models.Domain, shortCode string) string {
+	if domain != nil {
+		return domain.ShortURL(shortCode)
+	}
+	if h.publicShortURL != "" {
+		return h.publicShortURL + "/" + shortCode
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, r.Host, shortCode)
+}
+
+// isShortDomain reports whether a destination points at a registered short
+// domain, which would redirect back into the service
+func (h *URLHandler) isShortDomain(destination string) bool {
+	u, err := neturl.Parse(destination)
+	if err != nil {
+		return false
+	}
+	_, ok := h.domains.Lookup(u.Hostname())
+	return ok
+}
+
+// publicShortURLBase returns PUBLIC_SHORT_URL_DOMAIN without a trailing
+// slash
+func publicShortURLBase() string {
+	return strings.TrimSuffix(os.Getenv("PUBLIC_SHORT_URL_DOMAIN"), "/")
+}
+
+// publicShortURLHost returns the host of PUBLIC_SHORT_URL_DOMAIN, if set
+func publicShortURLHost() string {
+	u, err := neturl.Parse(publicShortURLBase())
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-service/audit"
+	"url-service/auth"
+	"url-service/models"
+	"url-service/storage"
+	"url-service/targeting"
+
+	"github.com/gorilla/mux"
+)
+
+// UpdateURL handles PUT /urls/{shortCode} requests
+func (h *URLHandler) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.findManaged(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updated := *current
+	if req.URL != nil {
+		destination, ok := h.checkDestination(w, r, *req.URL, "update")
+		if !ok {
+			return
+		}
+		updated.OriginalURL = destination
+	}
+	if req.Password != nil {
+		hash, ok := hashPassword(w, *req.Password)
+		if !ok {
+			return
+		}
+		updated.PasswordHash = hash
+	}
+	if req.MaxClicks != nil {
+		if *req.MaxClicks < 0 {
+			http.Error(w, "max_clicks must not be negative", http.StatusBadRequest)
+			return
+		}
+		updated.MaxClicks = *req.MaxClicks
+	}
+	if req.ActiveFrom != nil {
+		from, err := parseScheduleTime("active_from", *req.ActiveFrom)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updated.ActiveFrom = from
+	}
+	if req.ActiveUntil != nil {
+		until, err := parseScheduleTime("active_until", *req.ActiveUntil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updated.ActiveUntil = until
+	}
+	if req.FallbackURL != nil {
+		updated.FallbackURL = ""
+		if *req.FallbackURL != "" {
+			fallback, ok := h.checkDestination(w, r, *req.FallbackURL, "update")
+			if !ok {
+				return
+			}
+			updated.FallbackURL = fallback
+		}
+	}
+	if req.Rules != nil {
+		rules := *req.Rules
+		if !h.checkRules(w, r, rules, "update") {
+			return
+		}
+		updated.Rules = rules
+	}
+	if req.Variants != nil {
+		variants := *req.Variants
+		if !h.checkVariants(w, r, variants, "update") {
+			return
+		}
+		updated.Variants = variants
+	}
+	if req.UTM != nil {
+		utm, err := targeting.NormalizeUTM(req.UTM)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updated.UTM = utm
+	}
+	if req.ForwardQuery != nil {
+		updated.ForwardQuery = *req.ForwardQuery
+	}
+	if req.ForwardPath != nil {
+		updated.ForwardPath = *req.ForwardPath
+	}
+	if req.RedirectCode != nil {
+		updated.RedirectCode = *req.RedirectCode
+	}
+	if req.Robots != nil {
+		updated.Robots = *req.Robots
+	}
+	if !checkSchedule(w, &updated, req.ActiveUntil != nil && updated.ActiveUntil != nil) || !checkRedirectSettings(w, &updated) {
+		return
+	}
+
+	h.saveVersion(w, r, current, &updated, models.AuditURLUpdate, 0)
+}
+
+// GetHistory handles GET /urls/{shortCode}/history requests
+func (h *URLHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.findManaged(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := h.history.FindHistory(r.Context(), current.Key())
+	if err != nil {
+		http.Error(w, "Failed to retrieve history", http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		// Links created before versioning have no history until first edited
+		versions = append(versions, initialVersion(current))
+	}
+	for i, version := range versions {
+		redacted := *version
+		redacted.URL = version.URL.Redacted()
+		versions[i] = &redacted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// RollbackURL handles POST /urls/{shortCode}/rollback/{version} requests.
+// The restored destination becomes a new version, so the history itself is
+// never rewritten.
+func (h *URLHandler) RollbackURL(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.findManaged(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+	restoreAccess := false
+	if value := r.URL.Query().Get("restore_access"); value != "" {
+		if restoreAccess, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Invalid restore_access", http.StatusBadRequest)
+			return
+		}
+	}
+
+	target, err := h.history.FindVersion(r.Context(), current.Key(), version)
+	if errors.Is(err, storage.ErrVersionNotFound) && current.Version == 0 && version == 1 {
+		target, err = initialVersion(current), nil
+	}
+	if errors.Is(err, storage.ErrVersionNotFound) {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve version", http.StatusInternalServerError)
+		return
+	}
+
+	// The password and click limit in force stay unless the caller asks for
+	// the old ones back, so a rollback never silently lifts or reinstates
+	// them
+	updated := *current
+	updated.RestoreFrom(target.URL)
+	if restoreAccess {
+		updated.RestoreAccessFrom(target.URL)
+	}
+
+	// Every restored destination may have been blocklisted since it was
+	// replaced, and the rules and variants are checked against today's limits
+	if updated.OriginalURL, ok = h.checkDestination(w, r, updated.OriginalURL, "update"); !ok {
+		return
+	}
+	if updated.FallbackURL != "" {
+		if updated.FallbackURL, ok = h.checkDestination(w, r, updated.FallbackURL, "update"); !ok {
+			return
+		}
+	}
+	if !h.checkRules(w, r, updated.Rules, "update") || !h.checkVariants(w, r, updated.Variants, "update") {
+		return
+	}
+
+	h.saveVersion(w, r, current, &updated, models.AuditURLRollback, version)
+}
+
+// findManaged loads the link named in the path, on the domain named by the
+// domain query parameter, and checks that the caller may manage it. Admins
+// may manage every link, API keys the links they created.
+func (h *URLHandler) findManaged(w http.ResponseWriter, r *http.Request) (*models.URL, bool) {
+	url, err := h.storage.FindByShortCode(r.Context(), queryKey(r))
+	if errors.Is(err, storage.ErrURLNotFound) {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve URL", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	actor := auth.PrincipalFromContext(r.Context()).Actor
+	switch {
+	case actor == auth.ActorAdmin, url.Owner != "" && actor == url.Owner:
+		return url, true
+	case actor == auth.ActorAnonymous:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	default:
+		http.Error(w, "Only the link's owner or an admin can manage it", http.StatusForbidden)
+	}
+	return nil, false
+}
+
+// saveVersion stores updated as the version after current, recording it in
+// the history and the audit log
+func (h *URLHandler) saveVersion(w http.ResponseWriter, r *http.Request, current, updated *models.URL, action string, restoredFrom int) {
+	ctx := r.Context()
+
+	if current.Version == 0 {
+		// Give links created before versioning their first history entry
+		err := h.history.AppendVersion(ctx, initialVersion(current))
+		if err != nil && !errors.Is(err, storage.ErrVersionConflict) {
+			slog.ErrorContext(ctx, "Failed to record URL version", "short_code", current.ShortCode, "error", err)
+			http.Error(w, "Failed to update URL", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Replace fails if anyone, such as a moderator banning the link, changed
+	// it since it was read, so their change is never overwritten. Only the
+	// winner records the version.
+	updated.Version = current.CurrentVersion() + 1
+	if err := h.storage.Replace(ctx, current, updated); err != nil {
+		if errors.Is(err, storage.ErrURLConflict) || errors.Is(err, storage.ErrURLNotFound) {
+			http.Error(w, "URL was changed concurrently, retry the update", http.StatusConflict)
+			return
+		}
+		slog.ErrorContext(ctx, "Failed to save URL", "short_code", updated.ShortCode, "error", err)
+		http.Error(w, "Failed to update URL", http.StatusInternalServerError)
+		return
+	}
+	h.recordVersion(ctx, updated, restoredFrom)
+	if err := h.audit.Record(ctx, audit.Entry{Action: action, ShortCode: updated.Key(), Before: current, After: updated}); err != nil {
+		http.Error(w, "Failed to record audit entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.URLResponse{URL: updated.Redacted(), Warnings: redirectWarnings(updated)})
+}
+
+// recordVersion appends a snapshot of url to its history as url.Version.
+// The link is already saved by then, so a failure is only logged.
+func (h *URLHandler) recordVersion(ctx context.Context, url *models.URL, restoredFrom int) {
+	snapshot := *url
+	err := h.history.AppendVersion(ctx, &models.URLVersion{
+		ShortCode:    url.ShortCode,
+		Domain:       url.Domain,
+		Version:      url.Version,
+		ChangedAt:    time.Now(),
+		Actor:        auth.PrincipalFromContext(ctx).Actor,
+		RestoredFrom: restoredFrom,
+		URL:          &snapshot,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record URL version", "short_code", url.ShortCode, "version", url.Version, "error", err)
+	}
+}
+
+// initialVersion describes a link stored before versioning as version 1
+func initialVersion(url *models.URL) *models.URLVersion {
+	snapshot := *url
+	snapshot.Version = 1
+	return &models.URLVersion{
+		ShortCode: url.ShortCode,
+		Domain:    url.Domain,
+		Version:   1,
+		ChangedAt: url.CreatedAt,
+		Actor:     url.Owner,
+		URL:       &snapshot,
+	}
+}
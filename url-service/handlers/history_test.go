@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"url-service/audit"
+	"url-service/auth"
+	"url-service/domains"
+	"url-service/models"
+	"url-service/storage"
+	"url-service/validation"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestHandler returns a handler over memory storage whose validator
+// rejects blocked.example
+func newTestHandler(t *testing.T) (*URLHandler, *storage.MemoryStorage) {
+	t.Helper()
+	t.Setenv("PUBLIC_SHORT_URL_DOMAIN", "http://s.example.com")
+
+	store := storage.NewMemoryStorage()
+	registry, err := domains.NewRegistry(store, domains.Options{RefreshInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { registry.Close() })
+
+	h := NewURLHandler(store, URLHandlerOptions{
+		History: store,
+		Audit:   audit.NewLogger(store),
+		Validator: validation.NewURLValidator(validation.Options{
+			MaxLength:      2048,
+			AllowedSchemes: []string{"http", "https"},
+			BlockedHosts:   []string{"blocked.example"},
+		}),
+		Domains: registry,
+	})
+	return h, store
+}
+
+func adminContext() context.Context {
+	return auth.WithActor(context.Background(), auth.ActorAdmin)
+}
+
+func TestSaveVersionKeepsConcurrentBan(t *testing.T) {
+	h, store := newTestHandler(t)
+	ctx := adminContext()
+	if err := store.Save(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The edit reads the link, then a moderator bans it before it is saved
+	current, err := store.FindByShortCode(ctx, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := setStatus(ctx, store, h.audit, "abc123", models.URLStatusBanned, "phishing"); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := *current
+	updated.OriginalURL = "https://example.org"
+	r := httptest.NewRequest(http.MethodPut, "/urls/abc123", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	h.saveVersion(w, r, current, &updated, models.AuditURLUpdate, 0)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	stored, _ := store.FindByShortCode(ctx, "abc123")
+	if stored.Status != models.URLStatusBanned || stored.OriginalURL != "https://example.com" {
+		t.Errorf("stored link = %s %s, want the banned original", stored.Status, stored.OriginalURL)
+	}
+}
+
+func TestRollbackRevalidatesRestoredFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot models.URL
+		wantCode int
+	}{
+		{
+			name:     "clean version",
+			snapshot: models.URL{OriginalURL: "https://dest.example/v1"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "destination stored normalized",
+			snapshot: models.URL{OriginalURL: "HTTPS://Dest.Example/v1"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "blocked destination",
+			snapshot: models.URL{OriginalURL: "https://blocked.example/v1"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "blocked fallback",
+			snapshot: models.URL{OriginalURL: "https://dest.example/v1", FallbackURL: "https://blocked.example/later"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "blocked rule destination",
+			snapshot: models.URL{OriginalURL: "https://dest.example/v1", Rules: []models.RedirectRule{
+				{ID: "ios", Platforms: []string{"ios"}, Destination: "https://blocked.example/app"},
+			}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "blocked variant destination",
+			snapshot: models.URL{OriginalURL: "https://dest.example/v1", Variants: []models.Variant{
+				{ID: "a", Destination: "https://dest.example/a", Weight: 1},
+				{ID: "b", Destination: "https://blocked.example/b", Weight: 1},
+			}},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store := newTestHandler(t)
+			ctx := adminContext()
+
+			snapshot := tt.snapshot
+			snapshot.ShortCode = "abc123"
+			snapshot.Version = 1
+			if err := store.AppendVersion(ctx, &models.URLVersion{ShortCode: "abc123", Version: 1, URL: &snapshot}); err != nil {
+				t.Fatal(err)
+			}
+			current := &models.URL{ShortCode: "abc123", OriginalURL: "https://dest.example/v2", Version: 2}
+			if err := store.AppendVersion(ctx, &models.URLVersion{ShortCode: "abc123", Version: 2, URL: current}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(ctx, current); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/urls/abc123/rollback/1", nil).WithContext(ctx)
+			r = mux.SetURLVars(r, map[string]string{"shortCode": "abc123", "version": "1"})
+			w := httptest.NewRecorder()
+			h.RollbackURL(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			stored, _ := store.FindByShortCode(ctx, "abc123")
+			wantURL := "https://dest.example/v2"
+			if tt.wantCode == http.StatusOK {
+				wantURL = "https://dest.example/v1"
+			}
+			if stored.OriginalURL != wantURL {
+				t.Errorf("destination = %s, want %s", stored.OriginalURL, wantURL)
+			}
+		})
+	}
+}
+
+func TestRollbackRestoresAccessControlsOnlyOnRequest(t *testing.T) {
+	tests := []struct {
+		query         string
+		wantCode      int
+		wantMaxClicks int
+		wantPassword  string
+	}{
+		{"", http.StatusOK, 0, ""},
+		{"?restore_access=false", http.StatusOK, 0, ""},
+		{"?restore_access=true", http.StatusOK, 5, "old-hash"},
+		{"?restore_access=maybe", http.StatusBadRequest, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			h, store := newTestHandler(t)
+			ctx := adminContext()
+
+			old := &models.URL{ShortCode: "abc123", OriginalURL: "https://dest.example/v1", PasswordHash: "old-hash", MaxClicks: 5, Version: 1}
+			current := &models.URL{ShortCode: "abc123", OriginalURL: "https://dest.example/v2", Version: 2}
+			for _, url := range []*models.URL{old, current} {
+				if err := store.AppendVersion(ctx, &models.URLVersion{ShortCode: "abc123", Version: url.Version, URL: url}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.Save(ctx, current); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/urls/abc123/rollback/1"+tt.query, nil).WithContext(ctx)
+			r = mux.SetURLVars(r, map[string]string{"shortCode": "abc123", "version": "1"})
+			w := httptest.NewRecorder()
+			h.RollbackURL(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			stored, _ := store.FindByShortCode(ctx, "abc123")
+			if stored.OriginalURL != "https://dest.example/v1" {
+				t.Errorf("destination = %s, want the restored one", stored.OriginalURL)
+			}
+			if stored.MaxClicks != tt.wantMaxClicks || stored.PasswordHash != tt.wantPassword {
+				t.Errorf("max clicks %d, password %q; want %d, %q",
+					stored.MaxClicks, stored.PasswordHash, tt.wantMaxClicks, tt.wantPassword)
+			}
+		})
+	}
+}
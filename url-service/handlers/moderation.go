@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/audit"
+	"url-service/domains"
+	"url-service/models"
+	"url-service/storage"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxReportReasonLength  = 200
+	maxReportDetailsLength = 2000
+	defaultReportPageSize  = 100
+)
+
+// ModerationHandler handles abuse reports and admin status changes
+type ModerationHandler struct {
+	storage storage.URLStorage
+	reports storage.ReportStorage
+	domains *domains.Registry
+	audit   *audit.Logger
+}
+
+// NewModerationHandler creates a new moderation handler
+func NewModerationHandler(s storage.URLStorage, reports storage.ReportStorage, registry *domains.Registry, auditLog *audit.Logger) *ModerationHandler {
+	return &ModerationHandler{storage: s, reports: reports, domains: registry, audit: auditLog}
+}
+
+// ReportURL handles POST /report/{shortCode}?domain= requests from the
+// public. The report goes to the queue of the workspace owning the domain.
+func (h *ModerationHandler) ReportURL(w http.ResponseWriter, r *http.Request) {
+	shortCode, domain := mux.Vars(r)["shortCode"], queryDomain(r)
+	key := models.LinkKey(domain, shortCode)
+	ws := workspace.Default
+	if owner, ok := h.domains.Lookup(domain); ok {
+		ws = owner.Workspace
+	}
+	r = r.WithContext(workspace.NewContext(r.Context(), ws))
+
+	var req models.CreateReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	req.Details = strings.TrimSpace(req.Details)
+	if req.Reason == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Reason) > maxReportReasonLength || len(req.Details) > maxReportDetailsLength {
+		http.Error(w, "Report is too long", http.StatusBadRequest)
+		return
+	}
+
+	if !h.storage.Exists(r.Context(), key) {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	report := &models.Report{
+		ID:        newReportID(),
+		ShortCode: shortCode,
+		Domain:    domain,
+		Workspace: ws,
+		Reason:    req.Reason,
+		Details:   req.Details,
+		Status:    models.ReportStatusOpen,
+		CreatedAt: time.Now(),
+	}
+	if err := h.reports.SaveReport(r.Context(), report); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save report", "short_code", key, "error", err)
+		http.Error(w, "Failed to save report", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Link reported", "short_code", key, "report_id", report.ID)
+	if err := h.audit.Record(r.Context(), audit.Entry{
+		Action: models.AuditReportCreate, ShortCode: key, ReportID: report.ID, After: report,
+	}); err != nil {
+		http.Error(w, "Failed to record audit entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"id": report.ID, "status": report.Status})
+}
+
+func newReportID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ListReports handles GET /admin/reports?status=&limit= requests for the
+// workspace the admin acts within; the default is the open review queue
+func (h *ModerationHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.ReportStatusOpen
+	}
+	switch status {
+	case models.ReportStatusOpen, models.ReportStatusDismissed, models.ReportStatusActioned:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultReportPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	reports, err := h.reports.FindReports(r.Context(), status, limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve reports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// ResolveReport handles POST /admin/reports/{id}/resolve requests. Report
+// IDs are unique across workspaces, so the link is changed within the
+// report's workspace whichever one the admin acts within.
+func (h *ModerationHandler) ResolveReport(w http.ResponseWriter, r *http.Request) {
+	var req models.ResolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var linkStatus string
+	switch req.Action {
+	case "dismiss":
+	case "disable":
+		linkStatus = models.URLStatusDisabled
+	case "ban":
+		linkStatus = models.URLStatusBanned
+	default:
+		http.Error(w, `Action must be "dismiss", "disable" or "ban"`, http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.reports.FindReport(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, storage.ErrReportNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve report", http.StatusInternalServerError)
+		return
+	}
+	r = r.WithContext(workspace.NewContext(r.Context(), report.Workspace))
+
+	before := *report
+	reason := strings.TrimSpace(req.Reason)
+	if linkStatus != "" {
+		if reason == "" {
+			reason = report.Reason
+		}
+		key := models.LinkKey(report.Domain, report.ShortCode)
+		if _, err := setStatus(r.Context(), h.storage, h.audit, key, linkStatus, reason); err != nil && !errors.Is(err, storage.ErrURLNotFound) {
+			slog.ErrorContext(r.Context(), "Failed to update URL status", "short_code", key, "error", err)
+			http.Error(w, "Failed to update URL status", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	now := time.Now()
+	report.Status = models.ReportStatusActioned
+	if linkStatus == "" {
+		report.Status = models.ReportStatusDismissed
+	}
+	report.Resolution = reason
+	report.ResolvedAt = &now
+
+	if err := h.reports.SaveReport(r.Context(), report); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save report", "report_id", report.ID, "error", err)
+		http.Error(w, "Failed to save report", http.StatusInternalServerError)
+		return
+	}
+	if err := h.audit.Record(r.Context(), audit.Entry{
+		Action: models.AuditReportResolve, ShortCode: models.LinkKey(report.Domain, report.ShortCode), ReportID: report.ID, Before: &before, After: report,
+	}); err != nil {
+		http.Error(w, "Failed to record audit entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// UpdateStatus handles PUT /admin/urls/{shortCode}/status?domain= requests
+func (h *ModerationHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidURLStatus(req.Status) {
+		http.Error(w, `Status must be "active", "disabled" or "banned"`, http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Status != models.URLStatusActive && req.Reason == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+
+	url, err := setStatus(r.Context(), h.storage, h.audit, queryKey(r), req.Status, req.Reason)
+	if errors.Is(err, storage.ErrURLNotFound) {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to update URL status", "error", err)
+		http.Error(w, "Failed to update URL status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(url.Redacted())
+}
+
+// statusAttempts bounds how often setStatus retries a link that keeps
+// being edited concurrently
+const statusAttempts = 5
+
+// setStatus changes the status of the link stored under key, records the
+// change in the audit log and returns the updated copy. A link edited
+// concurrently is reloaded and the status applied again, so moderation
+// always wins over edits made in the meantime. An error recording the
+// change is returned even though the status was stored.
+func setStatus(ctx context.Context, s storage.URLStorage, auditLog *audit.Logger, key, status, reason string) (*models.URL, error) {
+	var current *models.URL
+	var updated models.URL
+	for attempt := 1; ; attempt++ {
+		var err error
+		current, err = s.FindByShortCode(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		// Storage may hand out shared values, so never modify them in place
+		updated = *current
+		now := time.Now()
+		updated.Status = status
+		updated.StatusReason = reason
+		updated.StatusUpdatedAt = &now
+		if status == models.URLStatusActive {
+			updated.StatusReason = ""
+		}
+
+		err = s.Replace(ctx, current, &updated)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, storage.ErrURLConflict) || attempt == statusAttempts {
+			return nil, err
+		}
+	}
+	slog.InfoContext(ctx, "URL status changed", "short_code", key, "status", status, "reason", updated.StatusReason)
+	if err := auditLog.Record(ctx, audit.Entry{Action: models.AuditURLStatus, ShortCode: key, Before: current, After: &updated}); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"url-service/models"
+)
+
+// page is an HTML response shown to visitors instead of a redirect
+type page struct {
+	Title   string
+	Message string
+	Detail  string
+	// PasswordForm asks for the link's passphrase, posting back to the link
+	PasswordForm bool
+	Error        string
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f5f5f5; color: #222; margin: 0; }
+main { max-width: 36rem; margin: 10vh auto; padding: 2rem; background: #fff; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,.1); }
+h1 { font-size: 1.5rem; margin-top: 0; }
+.detail { color: #666; font-size: .9rem; word-break: break-all; }
+.error { color: #b00020; }
+input { padding: .5rem; font-size: 1rem; width: 60%; }
+button { padding: .5rem 1rem; font-size: 1rem; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .Detail}}<p class="detail">{{.Detail}}</p>{{end}}
+{{if .PasswordForm}}<form method="post">
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<input type="password" name="password" aria-label="Passphrase" autocomplete="off" autofocus required>
+<button type="submit">Continue</button>
+</form>{{end}}
+</main>
+</body>
+</html>
+`))
+
+// renderPage writes an HTML page with the given status. Pages describe the
+// state of a link at this moment, so they are never cached.
+func renderPage(w http.ResponseWriter, r *http.Request, status int, p page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := pageTemplate.Execute(w, p); err != nil {
+		slog.WarnContext(r.Context(), "Failed to render page", "title", p.Title, "error", err)
+	}
+}
+
+// renderStatusPage explains why a non-active link does not redirect. Banned
+// links were removed for violating the terms of service and answer 451;
+// disabled links answer 410.
+func renderStatusPage(w http.ResponseWriter, r *http.Request, url *models.URL) {
+	if url.Status == models.URLStatusBanned {
+		renderPage(w, r, http.StatusUnavailableForLegalReasons, page{
+			Title:   "This link has been removed",
+			Message: "This short link was removed for violating our terms of service and is no longer available.",
+			Detail:  url.StatusReason,
+		})
+		return
+	}
+
+	renderPage(w, r, http.StatusGone, page{
+		Title:   "This link has been disabled",
+		Message: "This short link has been disabled and no longer redirects to its destination.",
+		Detail:  url.StatusReason,
+	})
+}
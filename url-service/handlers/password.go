@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"url-service/auth"
+	"url-service/password"
+	"url-service/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// UnlockURL handles POST /{shortCode} requests submitted by the passphrase
+// form. A correct passphrase sets the unlock cookie and sends the visitor
+// back to the link, with the same path and query, which then redirects as
+// usual.
+func (h *URLHandler) UnlockURL(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	r, key := h.hostRequest(r, shortCode)
+	url, err := h.storage.FindByShortCode(r.Context(), key)
+	if errors.Is(err, storage.ErrURLNotFound) {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve URL", http.StatusInternalServerError)
+		return
+	}
+	if !url.IsActive() {
+		renderStatusPage(w, r, url)
+		return
+	}
+	if !url.HasPassword() {
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := r.ParseForm(); err != nil {
+		renderPasswordPage(w, r, http.StatusBadRequest, "Invalid form submission.")
+		return
+	}
+
+	err = h.passwords.Verify(r.Context(), url, auth.PrincipalFromContext(r.Context()).IP, r.PostForm.Get("password"))
+	var throttled *password.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		slog.WarnContext(r.Context(), "Passphrase attempts throttled", "short_code", shortCode)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		renderPasswordPage(w, r, http.StatusTooManyRequests, "Too many attempts. Please wait a few minutes and try again.")
+		return
+	case errors.Is(err, password.ErrUnavailable):
+		renderPasswordPage(w, r, http.StatusServiceUnavailable, "Passphrases cannot be checked right now. Please try again later.")
+		return
+	case err != nil:
+		renderPasswordPage(w, r, http.StatusForbidden, "Incorrect passphrase.")
+		return
+	}
+
+	h.passwords.SetCookie(w, r, url)
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+// renderPasswordPage asks the visitor for a link's passphrase
+func renderPasswordPage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	renderPage(w, r, status, page{
+		Title:        "This link is protected",
+		Message:      "Enter the passphrase to continue to the destination.",
+		PasswordForm: true,
+		Error:        message,
+	})
+}
+
+// hashPassword hashes a new passphrase, answering the request itself when
+// the passphrase is rejected. An empty passphrase removes protection.
+func hashPassword(w http.ResponseWriter, passphrase string) (string, bool) {
+	if passphrase == "" {
+		return "", true
+	}
+	hash, err := password.Hash(passphrase)
+	if errors.Is(err, password.ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if err != nil {
+		http.Error(w, "Failed to hash passphrase", http.StatusInternalServerError)
+		return "", false
+	}
+	return hash, true
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-service/models"
+)
+
+// reserveLink claims a slot of the workspace's link quota for a new link,
+// answering the request itself when none is left
+func (h *URLHandler) reserveLink(w http.ResponseWriter, r *http.Request, url *models.URL) bool {
+	ws, _ := h.workspaces.Find(url.Workspace)
+	if ws == nil || ws.MaxLinks == 0 || h.quotas == nil {
+		return true
+	}
+
+	reserved, err := h.quotas.ReserveLink(r.Context(), url.Key(), ws.MaxLinks)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check link quota", "workspace", ws.ID, "error", err)
+		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	if !reserved {
+		http.Error(w, fmt.Sprintf("Workspace link quota reached: at most %d links", ws.MaxLinks), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// releaseLink frees the quota slot of a link that could not be saved
+func (h *URLHandler) releaseLink(ctx context.Context, url *models.URL) {
+	ws, _ := h.workspaces.Find(url.Workspace)
+	if ws == nil || ws.MaxLinks == 0 || h.quotas == nil {
+		return
+	}
+	if err := h.quotas.ReleaseLink(ctx, url.Key()); err != nil {
+		slog.WarnContext(ctx, "Failed to release link quota", "workspace", ws.ID, "error", err)
+	}
+}
+
+// allowMonthlyClick counts a redirect against the workspace's monthly
+// quota, answering the request itself once the quota is used up. Counter
+// failures let the redirect through: the quota bounds usage, it is not
+// worth an outage.
+func (h *URLHandler) allowMonthlyClick(w http.ResponseWriter, r *http.Request, url *models.URL) bool {
+	ws, _ := h.workspaces.Find(url.Workspace)
+	if ws == nil || ws.MaxMonthlyClicks == 0 || h.quotas == nil {
+		return true
+	}
+
+	allowed, err := h.quotas.ConsumeMonthlyClick(r.Context(), ws.MaxMonthlyClicks)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to count monthly click", "workspace", ws.ID, "error", err)
+		return true
+	}
+	if allowed {
+		return true
+	}
+
+	now := time.Now().UTC()
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	w.Header().Set("Retry-After", strconv.Itoa(int(nextMonth.Sub(now).Seconds())+1))
+	w.Header().Set("Cache-Control", "no-store")
+	renderPage(w, r, http.StatusTooManyRequests, page{
+		Title:   "This link is temporarily unavailable",
+		Message: "The owner of this short link has used up this month's redirects. Please try again later.",
+	})
+	return false
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"url-service/models"
+	"url-service/targeting"
+)
+
+// RedirectOptions controls the caching and indexing headers of redirects,
+// and what visitors outside a link's activation window get
+type RedirectOptions struct {
+	// PermanentMaxAge is how long browsers and proxies may cache a 301 or
+	// 308 redirect
+	PermanentMaxAge time.Duration
+	// RobotsTag is the X-Robots-Tag of links that set none; empty sends none
+	RobotsTag string
+	// PendingURL and EndedURL receive visitors before and after the window
+	// of links without a fallback URL; empty shows a built-in page
+	PendingURL string
+	EndedURL   string
+	// PendingStatus is the status of the built-in page shown before a
+	// window opens: 200, 404 or 503
+	PendingStatus int
+}
+
+// RedirectOptionsFromEnv reads redirect settings from the environment
+func RedirectOptionsFromEnv() (RedirectOptions, error) {
+	opts := RedirectOptions{PermanentMaxAge: 24 * time.Hour, PendingStatus: http.StatusNotFound}
+
+	if value := os.Getenv("REDIRECT_PERMANENT_MAX_AGE"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return opts, fmt.Errorf("invalid REDIRECT_PERMANENT_MAX_AGE %q", value)
+		}
+		opts.PermanentMaxAge = d
+	}
+
+	tag, ok := models.NormalizeRobotsTag(os.Getenv("REDIRECT_ROBOTS_TAG"))
+	if !ok {
+		return opts, fmt.Errorf("invalid REDIRECT_ROBOTS_TAG %q", os.Getenv("REDIRECT_ROBOTS_TAG"))
+	}
+	opts.RobotsTag = tag
+
+	for _, setting := range []struct {
+		name  string
+		value *string
+	}{{"SCHEDULE_PENDING_URL", &opts.PendingURL}, {"SCHEDULE_ENDED_URL", &opts.EndedURL}} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return opts, fmt.Errorf("invalid %s %q: must be an absolute http or https URL", setting.name, value)
+		}
+		*setting.value = value
+	}
+
+	if value := os.Getenv("SCHEDULE_PENDING_STATUS"); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || (status != http.StatusOK && status != http.StatusNotFound && status != http.StatusServiceUnavailable) {
+			return opts, fmt.Errorf("invalid SCHEDULE_PENDING_STATUS %q: must be 200, 404 or 503", value)
+		}
+		opts.PendingStatus = status
+	}
+
+	return opts, nil
+}
+
+// checkRedirectSettings validates and normalizes a link's redirect code and
+// robots tag, answering the request itself when either is invalid
+func checkRedirectSettings(w http.ResponseWriter, url *models.URL) bool {
+	if url.RedirectCode != 0 && !models.ValidRedirectCode(url.RedirectCode) {
+		http.Error(w, "redirect_code must be 301, 302, 307 or 308", http.StatusBadRequest)
+		return false
+	}
+	robots, ok := models.NormalizeRobotsTag(url.Robots)
+	if !ok {
+		http.Error(w, "robots must list X-Robots-Tag directives: all, none, noindex, nofollow, noarchive or nosnippet", http.StatusBadRequest)
+		return false
+	}
+	url.Robots = robots
+	return true
+}
+
+// cacheable reports whether every visitor gets the same redirect from the
+// link, at any time, without it having to see the visit
+func cacheable(url *models.URL) bool {
+	return !url.HasSchedule() && len(url.Rules) == 0 && len(url.Variants) == 0 &&
+		!targeting.DependsOnVisitor(url.UTM) && !url.HasPassword() && url.MaxClicks == 0
+}
+
+// redirectWarnings explains the consequences of a permanent redirect code
+func redirectWarnings(url *models.URL) []string {
+	if !url.PermanentRedirect() {
+		return nil
+	}
+	if !cacheable(url) {
+		return []string{fmt.Sprintf("redirect_code %d is sent uncached: the link's schedule, rules, variants, "+
+			"UTM placeholders, passphrase or click limit need every visit to reach the service", url.RedirectStatus())}
+	}
+	return []string{fmt.Sprintf("redirect_code %d is permanent: browsers and proxies cache the redirect, so repeat "+
+		"visits are not counted in analytics and later edits may not reach visitors who already followed the link",
+		url.RedirectStatus())}
+}
+
+// setRobotsTag sends the link's X-Robots-Tag, or the service default
+func (h *URLHandler) setRobotsTag(w http.ResponseWriter, url *models.URL) {
+	tag := url.Robots
+	if tag == "" {
+		tag = h.redirects.RobotsTag
+	}
+	if tag != "" && tag != "all" {
+		w.Header().Set("X-Robots-Tag", tag)
+	}
+}
+
+// setRedirectCaching lets permanent redirects be cached unless the visit
+// already ruled caching out, and makes every other redirect revalidate
+func (h *URLHandler) setRedirectCaching(w http.ResponseWriter, url *models.URL) {
+	if w.Header().Get("Cache-Control") != "" {
+		return
+	}
+	if !url.PermanentRedirect() {
+		w.Header().Set("Cache-Control", "no-cache")
+		return
+	}
+	maxAge := h.redirects.PermanentMaxAge
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	w.Header().Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+}
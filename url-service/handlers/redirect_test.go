@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// visit sends a request for shortCode through the handler
+func visit(h *URLHandler, method, target, shortCode string) *httptest.ResponseRecorder {
+	r := mux.SetURLVars(httptest.NewRequest(method, target, nil), map[string]string{"shortCode": shortCode})
+	w := httptest.NewRecorder()
+	h.RedirectURL(w, r)
+	return w
+}
+
+func TestRedirectCodeAndCaching(t *testing.T) {
+	h, store := newTestHandler(t)
+	h.redirects = RedirectOptions{PermanentMaxAge: time.Hour}
+	until := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		url          models.URL
+		wantCode     int
+		wantCache    string
+		wantExpires  bool
+		wantWarnings bool
+	}{
+		{models.URL{ShortCode: "default"}, http.StatusFound, "no-cache", false, false},
+		{models.URL{ShortCode: "found", RedirectCode: 302}, http.StatusFound, "no-cache", false, false},
+		{models.URL{ShortCode: "temporary", RedirectCode: 307}, http.StatusTemporaryRedirect, "no-cache", false, false},
+		{models.URL{ShortCode: "moved", RedirectCode: 301}, http.StatusMovedPermanently, "public, max-age=3600", true, true},
+		{models.URL{ShortCode: "permanent", RedirectCode: 308}, http.StatusPermanentRedirect, "public, max-age=3600", true, true},
+		// A schedule needs every visit, so even permanent redirects are not cached
+		{models.URL{ShortCode: "scheduled", RedirectCode: 301, ActiveUntil: &until}, http.StatusMovedPermanently, "no-store", false, true},
+		// So does a click limit
+		{models.URL{ShortCode: "limited", RedirectCode: 308, MaxClicks: 5}, http.StatusPermanentRedirect, "private, no-store", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url.ShortCode, func(t *testing.T) {
+			url := tt.url
+			url.OriginalURL = "https://example.com/dest"
+			if err := store.Save(adminContext(), &url); err != nil {
+				t.Fatal(err)
+			}
+			if url.MaxClicks > 0 {
+				h.counter = store
+			}
+
+			w := visit(h, http.MethodGet, "/"+url.ShortCode, url.ShortCode)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Location"); got != "https://example.com/dest" {
+				t.Errorf("Location = %q", got)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCache)
+			}
+			if expires := w.Header().Get("Expires"); (expires != "") != tt.wantExpires {
+				t.Errorf("Expires = %q, want set %v", expires, tt.wantExpires)
+			}
+			if got := len(redirectWarnings(&url)) > 0; got != tt.wantWarnings {
+				t.Errorf("warnings = %v, want %v", redirectWarnings(&url), tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestCreateRejectsInvalidRedirectSettings(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	tests := []struct {
+		body     string
+		wantCode int
+	}{
+		{`{"url":"https://example.org/","redirect_code":301}`, http.StatusCreated},
+		{`{"url":"https://example.org/","redirect_code":307,"robots":"NoIndex, nofollow"}`, http.StatusCreated},
+		{`{"url":"https://example.org/","redirect_code":303}`, http.StatusBadRequest},
+		{`{"url":"https://example.org/","redirect_code":200}`, http.StatusBadRequest},
+		{`{"url":"https://example.org/","redirect_code":-1}`, http.StatusBadRequest},
+		{`{"url":"https://example.org/","robots":"noindex, follow-me"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(tt.body)).WithContext(adminContext())
+		w := httptest.NewRecorder()
+		h.CreateShortURL(w, r)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status = %d, want %d: %s", tt.body, w.Code, tt.wantCode, w.Body)
+		}
+	}
+}
+
+func TestRedirectRobotsTag(t *testing.T) {
+	h, store := newTestHandler(t)
+	h.redirects = RedirectOptions{RobotsTag: "noindex"}
+	for _, url := range []*models.URL{
+		{ShortCode: "inherits", OriginalURL: "https://example.com/"},
+		{ShortCode: "own", OriginalURL: "https://example.com/", Robots: "noindex, nofollow"},
+		{ShortCode: "indexed", OriginalURL: "https://example.com/", Robots: "all"},
+		{ShortCode: "disabled", OriginalURL: "https://example.com/", Status: models.URLStatusDisabled, StatusReason: "spam"},
+	} {
+		if err := store.Save(adminContext(), url); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		shortCode string
+		want      string
+	}{
+		{"inherits", "noindex"},
+		{"own", "noindex, nofollow"},
+		{"indexed", ""},
+		// Status pages of a link carry its tag too
+		{"disabled", "noindex"},
+	}
+	for _, tt := range tests {
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			w := visit(h, method, "/"+tt.shortCode, tt.shortCode)
+			if got := w.Header().Get("X-Robots-Tag"); got != tt.want {
+				t.Errorf("%s %s: X-Robots-Tag = %q, want %q", method, tt.shortCode, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestHeadDoesNotCountClicks(t *testing.T) {
+	var tracked atomic.Int32
+	analytics := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracked.Add(1)
+	}))
+	defer analytics.Close()
+	t.Setenv("ANALYTICS_SERVICE_URL", analytics.URL)
+
+	h, store := newTestHandler(t)
+	workspaces, err := workspace.NewRegistry([]workspace.Workspace{{ID: "acme", MaxMonthlyClicks: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.counter, h.quotas, h.workspaces = store, store, workspaces
+	ctx := adminContext()
+	if err := h.domains.Add(ctx, &models.Domain{Host: "go.acme.test", Scheme: "https", Workspace: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	acme := workspace.NewContext(ctx, "acme")
+	for _, url := range []*models.URL{
+		{ShortCode: "open", Domain: "go.acme.test", Workspace: "acme", OriginalURL: "https://example.com/"},
+		{ShortCode: "once", Domain: "go.acme.test", Workspace: "acme", OriginalURL: "https://example.com/", MaxClicks: 1},
+	} {
+		if err := store.Save(acme, url); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for range 3 {
+		if w := visit(h, http.MethodHead, "https://go.acme.test/open", "open"); w.Code != http.StatusFound {
+			t.Fatalf("HEAD of an open link = %d, want %d", w.Code, http.StatusFound)
+		}
+		w := visit(h, http.MethodHead, "https://go.acme.test/once", "once")
+		if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+			t.Fatalf("HEAD of a limited link = %d to %q, want 200 without a Location", w.Code, w.Header().Get("Location"))
+		}
+	}
+	if err := h.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := tracked.Load(); got != 0 {
+		t.Errorf("HEAD requests tracked %d clicks", got)
+	}
+
+	// The link's single click and the workspace's single monthly redirect
+	// are both still there
+	if w := visit(h, http.MethodGet, "https://go.acme.test/once", "once"); w.Code != http.StatusFound {
+		t.Fatalf("GET after HEADs = %d, want %d", w.Code, http.StatusFound)
+	}
+	h.Drain(context.Background())
+	if got := tracked.Load(); got != 1 {
+		t.Errorf("GET tracked %d clicks, want 1", got)
+	}
+}
+
+func TestRedirectWarningsInCreateResponse(t *testing.T) {
+	h, _ := newTestHandler(t)
+	r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url":"https://example.org/","redirect_code":308}`)).WithContext(adminContext())
+	w := httptest.NewRecorder()
+	h.CreateShortURL(w, r)
+
+	var resp models.CreateURLResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "permanent") {
+		t.Errorf("warnings = %q, want the permanent redirect caveat", resp.Warnings)
+	}
+}
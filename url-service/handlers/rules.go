@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"url-service/models"
+	"url-service/targeting"
+)
+
+// checkRules validates redirect rules and their destinations, answering the
+// request itself when one is rejected
+func (h *URLHandler) checkRules(w http.ResponseWriter, r *http.Request, rules []models.RedirectRule, stage string) bool {
+	if err := targeting.Normalize(rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	for i := range rules {
+		destination, ok := h.checkDestination(w, r, rules[i].Destination, stage)
+		if !ok {
+			return false
+		}
+		rules[i].Destination = destination
+	}
+	return true
+}
+
+// ruleID names the rule that fired, or "" when the link's own destination
+// was used
+func ruleID(rule *models.RedirectRule) string {
+	if rule == nil {
+		return ""
+	}
+	return rule.ID
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-service/models"
+)
+
+// scheduleTimeFormat shows activation times to visitors
+const scheduleTimeFormat = "2 January 2006, 15:04 MST"
+
+// checkSchedule validates a link's activation window, answering the request
+// itself when it is invalid. A window that has already ended is only
+// rejected when its end is being set, so links past their window can still
+// be edited.
+func checkSchedule(w http.ResponseWriter, url *models.URL, endChanged bool) bool {
+	from, until := url.ActiveFrom, url.ActiveUntil
+	switch {
+	case from != nil && until != nil && !until.After(*from):
+		http.Error(w, "active_until must be after active_from", http.StatusBadRequest)
+	case endChanged && until != nil && !until.After(time.Now()):
+		http.Error(w, "active_until must be in the future", http.StatusBadRequest)
+	case url.FallbackURL != "" && !url.HasSchedule():
+		http.Error(w, "fallback_url requires active_from or active_until", http.StatusBadRequest)
+	default:
+		return true
+	}
+	return false
+}
+
+// parseScheduleTime parses an RFC 3339 window bound from an update request;
+// an empty value removes the bound
+func parseScheduleTime(field, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time", field)
+	}
+	return &t, nil
+}
+
+// serveOutsideWindow answers a visit before or after a link's activation
+// window: with the link's fallback URL if it has one, then the service's
+// configured one, otherwise with a page saying when the link goes live or
+// that it has expired
+func (h *URLHandler) serveOutsideWindow(w http.ResponseWriter, r *http.Request, url *models.URL, state string) {
+	fallback := url.FallbackURL
+	if fallback == "" {
+		fallback = h.redirects.EndedURL
+		if state == models.SchedulePending {
+			fallback = h.redirects.PendingURL
+		}
+	}
+	if fallback != "" {
+		// The answer changes when the window opens or closes
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, fallback, http.StatusFound)
+		return
+	}
+
+	if state == models.SchedulePending {
+		status := h.redirects.PendingStatus
+		if status == 0 {
+			status = http.StatusNotFound
+		}
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(*url.ActiveFrom).Seconds()))))
+		}
+		renderPage(w, r, status, page{
+			Title:   "Coming soon",
+			Message: "This short link is not live yet. Please check back later.",
+			Detail:  "Available from " + url.ActiveFrom.UTC().Format(scheduleTimeFormat),
+		})
+		return
+	}
+
+	renderPage(w, r, http.StatusGone, page{
+		Title:   "This link has expired",
+		Message: "This short link is no longer available.",
+	})
+}
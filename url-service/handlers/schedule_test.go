@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"url-service/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseScheduleTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2030-01-01T00:00:00Z", want: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// An offset names the same instant as its UTC equivalent
+		{value: "2030-01-01T01:30:00+01:30", want: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "2029-12-31T19:00:00-05:00", want: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "2030-01-01", wantErr: true},
+		{value: "2030-01-01T00:00:00", wantErr: true},
+		{value: "tomorrow", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseScheduleTime("active_from", tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseScheduleTime(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseScheduleTime(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	if got, err := parseScheduleTime("active_from", ""); got != nil || err != nil {
+		t.Errorf("empty value = %v, %v; want the bound removed", got, err)
+	}
+}
+
+func TestCheckSchedule(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	tests := []struct {
+		name       string
+		url        models.URL
+		endChanged bool
+		want       bool
+	}{
+		{"no window", models.URL{}, true, true},
+		{"open-ended start", models.URL{ActiveFrom: at(time.Hour)}, true, true},
+		{"window", models.URL{ActiveFrom: at(time.Hour), ActiveUntil: at(2 * time.Hour)}, true, true},
+		{"end before start", models.URL{ActiveFrom: at(2 * time.Hour), ActiveUntil: at(time.Hour)}, true, false},
+		{"end equal to start", models.URL{ActiveFrom: at(time.Hour), ActiveUntil: at(time.Hour)}, true, false},
+		{"end in the past", models.URL{ActiveUntil: at(-time.Hour)}, true, false},
+		{"ended window left alone", models.URL{ActiveUntil: at(-time.Hour)}, false, true},
+		{"fallback without a window", models.URL{FallbackURL: "https://example.com"}, true, false},
+		{"fallback with a window", models.URL{ActiveUntil: at(time.Hour), FallbackURL: "https://example.com"}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if got := checkSchedule(w, &tt.url, tt.endChanged); got != tt.want {
+				t.Errorf("checkSchedule = %v, want %v: %s", got, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestRedirectOutsideWindow(t *testing.T) {
+	// Offsets other than UTC must not shift the window
+	east := time.FixedZone("UTC+14", 14*60*60)
+	west := time.FixedZone("UTC-12", -12*60*60)
+	soon := time.Now().Add(time.Hour).In(east)
+	past := time.Now().Add(-time.Hour).In(west)
+	justStarted := time.Now().Add(-time.Second).In(east)
+
+	tests := []struct {
+		name     string
+		url      models.URL
+		opts     RedirectOptions
+		wantCode int
+		wantTo   string
+	}{
+		{name: "no window", url: models.URL{}, wantCode: http.StatusFound, wantTo: "https://example.com/dest"},
+		{name: "live", url: models.URL{ActiveFrom: &justStarted, ActiveUntil: &soon}, wantCode: http.StatusFound, wantTo: "https://example.com/dest"},
+		{name: "before start", url: models.URL{ActiveFrom: &soon}, wantCode: http.StatusNotFound},
+		{name: "after end", url: models.URL{ActiveUntil: &past}, wantCode: http.StatusGone},
+		{
+			name:     "before start with the configured status",
+			url:      models.URL{ActiveFrom: &soon},
+			opts:     RedirectOptions{PendingStatus: http.StatusServiceUnavailable},
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "before start with the configured page",
+			url:      models.URL{ActiveFrom: &soon},
+			opts:     RedirectOptions{PendingURL: "https://example.com/soon", EndedURL: "https://example.com/over"},
+			wantCode: http.StatusFound,
+			wantTo:   "https://example.com/soon",
+		},
+		{
+			name:     "after end with the configured page",
+			url:      models.URL{ActiveUntil: &past},
+			opts:     RedirectOptions{PendingURL: "https://example.com/soon", EndedURL: "https://example.com/over"},
+			wantCode: http.StatusFound,
+			wantTo:   "https://example.com/over",
+		},
+		{
+			name:     "link fallback before the configured page",
+			url:      models.URL{ActiveFrom: &soon, FallbackURL: "https://example.com/own"},
+			opts:     RedirectOptions{PendingURL: "https://example.com/soon"},
+			wantCode: http.StatusFound,
+			wantTo:   "https://example.com/own",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store := newTestHandler(t)
+			h.redirects = tt.opts
+			url := tt.url
+			url.ShortCode, url.OriginalURL = "abc123", "https://example.com/dest"
+			if err := store.Save(adminContext(), &url); err != nil {
+				t.Fatal(err)
+			}
+
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/abc123", nil), map[string]string{"shortCode": "abc123"})
+			w := httptest.NewRecorder()
+			h.RedirectURL(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantTo {
+				t.Errorf("Location = %q, want %q", got, tt.wantTo)
+			}
+			if tt.wantCode == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+				t.Error("503 without Retry-After")
+			}
+		})
+	}
+}
+
+func TestRedirectOptionsFromEnvSchedule(t *testing.T) {
+	t.Setenv("SCHEDULE_PENDING_URL", "https://example.com/soon")
+	t.Setenv("SCHEDULE_PENDING_STATUS", "503")
+	opts, err := RedirectOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.PendingURL != "https://example.com/soon" || opts.EndedURL != "" || opts.PendingStatus != http.StatusServiceUnavailable {
+		t.Errorf("opts = %+v", opts)
+	}
+
+	for name, value := range map[string]string{
+		"SCHEDULE_ENDED_URL":      "/over",
+		"SCHEDULE_PENDING_STATUS": "302",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := RedirectOptionsFromEnv(); err == nil {
+				t.Errorf("%s=%s accepted", name, value)
+			}
+		})
+	}
+}
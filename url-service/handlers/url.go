@@ -2,19 +2,36 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"os"
-	"strings"
+	"sync"
 	"time"
 
+	"linkshort/pkg/logging"
+	"linkshort/pkg/workspace"
+
+	"url-service/audit"
+	"url-service/auth"
+	"url-service/domains"
+	"url-service/metrics"
 	"url-service/models"
+	"url-service/password"
+	"url-service/screening"
 	"url-service/storage"
+	"url-service/targeting"
+	"url-service/tracing"
+	"url-service/validation"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -25,24 +42,81 @@ const (
 // URLHandler handles URL-related HTTP requests
 type URLHandler struct {
 	storage             storage.URLStorage
+	history             storage.HistoryStorage
+	counter             storage.ClickCounter
+	validator           *validation.URLValidator
+	screener            screening.DestinationScreener // nil when screening is off
+	screenTimeout       time.Duration                 // how long redirects wait for a verdict
+	audit               *audit.Logger
+	passwords           *password.Guard
+	redirects           RedirectOptions
+	domains             *domains.Registry
+	workspaces          *workspace.Registry
+	quotas              storage.QuotaCounter
+	publicShortURL      string // PUBLIC_SHORT_URL_DOMAIN, the default domain's base URL
 	analyticsServiceURL string
+	trackToken          string // ANALYTICS_TRACK_TOKEN, sent with every click
+	client              *http.Client
+	clicks              sync.WaitGroup // click deliveries still in flight
+}
+
+// URLHandlerOptions holds the collaborators of a URLHandler
+type URLHandlerOptions struct {
+	History   storage.HistoryStorage
+	Counter   storage.ClickCounter
+	Validator *validation.URLValidator
+	// Screener checks destinations; nil disables screening
+	Screener screening.DestinationScreener
+	// RedirectScreenTimeout bounds how long a redirect waits for a verdict;
+	// 0 waits as long as the screener takes
+	RedirectScreenTimeout time.Duration
+	Audit                 *audit.Logger
+	// Passwords verifies passphrases of protected links
+	Passwords *password.Guard
+	// Redirects sets the caching and indexing headers of redirects
+	Redirects RedirectOptions
+	// Domains maps request hosts to registered short domains
+	Domains *domains.Registry
+	// Workspaces holds the quotas of each workspace, which Quotas enforces
+	Workspaces *workspace.Registry
+	Quotas     storage.QuotaCounter
 }
 
 // NewURLHandler creates a new URL handler
-func NewURLHandler(s storage.URLStorage) *URLHandler {
+func NewURLHandler(s storage.URLStorage, opts URLHandlerOptions) *URLHandler {
 	analyticsURL := os.Getenv("ANALYTICS_SERVICE_URL")
 	if analyticsURL == "" {
 		analyticsURL = "http://localhost:8081"
 	}
+	if publicShortURLBase() == "" {
+		slog.Warn("PUBLIC_SHORT_URL_DOMAIN is not set, short URLs will be built from the request's Host header")
+	}
 
 	return &URLHandler{
 		storage:             s,
+		history:             opts.History,
+		counter:             opts.Counter,
+		validator:           opts.Validator,
+		screener:            opts.Screener,
+		screenTimeout:       opts.RedirectScreenTimeout,
+		audit:               opts.Audit,
+		passwords:           opts.Passwords,
+		redirects:           opts.Redirects,
+		domains:             opts.Domains,
+		workspaces:          opts.Workspaces,
+		quotas:              opts.Quotas,
+		publicShortURL:      publicShortURLBase(),
 		analyticsServiceURL: analyticsURL,
+		trackToken:          os.Getenv("ANALYTICS_TRACK_TOKEN"),
+		client: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
 	}
 }
 
-// generateShortCode creates a random alphanumeric string
-func (h *URLHandler) generateShortCode() string {
+// generateShortCode creates a random alphanumeric string, unique on domain
+func (h *URLHandler) generateShortCode(ctx context.Context, domain string) string {
 	rand.Seed(time.Now().UnixNano())
 
 	for {
@@ -53,21 +127,12 @@ func (h *URLHandler) generateShortCode() string {
 		shortCode := string(code)
 
 		// Ensure uniqueness
-		if !h.storage.Exists(shortCode) {
+		if !h.storage.Exists(ctx, models.LinkKey(domain, shortCode)) {
 			return shortCode
 		}
 	}
 }
 
-// normalizeURL ensures the URL has a valid scheme
-func normalizeURL(rawURL string) string {
-	rawURL = strings.TrimSpace(rawURL)
-	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
-		return "https://" + rawURL
-	}
-	return rawURL
-}
-
 // CreateShortURL handles POST /shorten requests
 func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateURLRequest
@@ -80,33 +145,99 @@ func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "URL is required", http.StatusBadRequest)
 		return
 	}
+	if req.MaxClicks < 0 {
+		http.Error(w, "max_clicks must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	domain, ok := h.resolveDomain(w, r, req.Domain)
+	if !ok {
+		return
+	}
+
+	originalURL, ok := h.checkDestination(w, r, req.URL, "create")
+	if !ok {
+		return
+	}
 
-	originalURL := normalizeURL(req.URL)
-	shortCode := h.generateShortCode()
+	var passwordHash string
+	if req.Password != "" {
+		if passwordHash, ok = hashPassword(w, req.Password); !ok {
+			return
+		}
+	}
+
+	if !h.checkRules(w, r, req.Rules, "create") || !h.checkVariants(w, r, req.Variants, "create") {
+		return
+	}
+	utm, err := targeting.NormalizeUTM(req.UTM)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var fallbackURL string
+	if req.FallbackURL != "" {
+		if fallbackURL, ok = h.checkDestination(w, r, req.FallbackURL, "create"); !ok {
+			return
+		}
+	}
 
 	url := &models.URL{
-		ID:          shortCode,
-		ShortCode:   shortCode,
 		OriginalURL: originalURL,
 		CreatedAt:   time.Now(),
+		Status:      models.URLStatusActive,
+		Version:     1,
+
+		PasswordHash: passwordHash,
+		MaxClicks:    req.MaxClicks,
+		ActiveFrom:   req.ActiveFrom,
+		ActiveUntil:  req.ActiveUntil,
+		FallbackURL:  fallbackURL,
+		Rules:        req.Rules,
+		Variants:     req.Variants,
+		UTM:          utm,
+		ForwardQuery: req.ForwardQuery,
+		ForwardPath:  req.ForwardPath,
+		RedirectCode: req.RedirectCode,
+		Robots:       req.Robots,
+		Workspace:    workspace.FromContext(r.Context()),
+	}
+	if !checkSchedule(w, url, true) || !checkRedirectSettings(w, url) {
+		return
 	}
 
-	if err := h.storage.Save(url); err != nil {
+	if domain != nil {
+		url.Domain = domain.Host
+	}
+	shortCode := h.generateShortCode(r.Context(), url.Domain)
+	url.ShortCode = shortCode
+	url.ID = url.Key()
+	if actor := auth.PrincipalFromContext(r.Context()).Actor; actor != auth.ActorAnonymous {
+		url.Owner = actor
+	}
+
+	if !h.reserveLink(w, r, url) {
+		return
+	}
+	if err := h.storage.Save(r.Context(), url); err != nil {
+		h.releaseLink(r.Context(), url)
+		slog.ErrorContext(r.Context(), "Failed to save URL", "short_code", shortCode, "error", err)
 		http.Error(w, "Failed to save URL", http.StatusInternalServerError)
 		return
 	}
-
-	// Get the host from the request for the short URL
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
+	h.recordVersion(r.Context(), url, 0)
+	if err := h.audit.Record(r.Context(), audit.Entry{Action: models.AuditURLCreate, ShortCode: url.Key(), After: url}); err != nil {
+		http.Error(w, "Failed to record audit entry", http.StatusInternalServerError)
+		return
 	}
-	host := r.Host
 
 	response := models.CreateURLResponse{
 		ShortCode:   shortCode,
-		ShortURL:    fmt.Sprintf("%s://%s/%s", scheme, host, shortCode),
+		Domain:      url.Domain,
+		ShortURL:    h.shortURL(r, domain, shortCode),
 		OriginalURL: originalURL,
+		Warnings:    redirectWarnings(url),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -114,61 +245,364 @@ func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// RedirectURL handles GET /{shortCode} requests
+// checkDestination validates and screens a destination, answering the
+// request itself when the destination is rejected
+func (h *URLHandler) checkDestination(w http.ResponseWriter, r *http.Request, rawURL, stage string) (string, bool) {
+	// The Host this request arrived on also serves short links, so a
+	// destination pointing at it would redirect to itself
+	destination, err := h.validator.Normalize(r.Context(), rawURL, r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if h.isShortDomain(destination) {
+		http.Error(w, "invalid URL: destination is a short link domain", http.StatusBadRequest)
+		return "", false
+	}
+	if verdict := h.screen(r.Context(), destination, stage); verdict.Blocked {
+		http.Error(w, "Destination blocked: "+verdict.Reason, http.StatusBadRequest)
+		return "", false
+	}
+	return destination, true
+}
+
+// RedirectURL handles GET and HEAD /{shortCode} and, for links forwarding
+// their path, /{shortCode}/{rest} requests. HEAD requests are answered like
+// GET but never count as clicks.
 func (h *URLHandler) RedirectURL(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	vars := mux.Vars(r)
 	shortCode := vars["shortCode"]
 
-	url, err := h.storage.FindByShortCode(shortCode)
+	r, key := h.hostRequest(r, shortCode)
+	url, err := h.storage.FindByShortCode(r.Context(), key)
+	if err == nil && vars["rest"] != "" && !url.ForwardPath {
+		err = storage.ErrURLNotFound
+	}
 	if err != nil {
 		http.Error(w, "URL not found", http.StatusNotFound)
+		metrics.ObserveRedirect("not_found", start)
+		return
+	}
+	h.setRobotsTag(w, url)
+
+	if !url.IsActive() {
+		renderStatusPage(w, r, url)
+		metrics.ObserveRedirect(url.Status, start)
+		return
+	}
+
+	destination := url.OriginalURL
+	var variant *models.Variant
+	visitor := targeting.VisitorFromRequest(r)
+	rule := targeting.Match(url.Rules, visitor)
+	if rule != nil {
+		destination = rule.Destination
+	} else if len(url.Variants) > 0 {
+		if variant = chooseVariant(r, url); variant != nil {
+			destination = variant.Destination
+		}
+	}
+
+	if state := url.ScheduleState(time.Now()); state != models.ScheduleLive {
+		h.serveOutsideWindow(w, r, url, state)
+		metrics.ObserveRedirect(state, start)
+		return
+	}
+	if url.HasSchedule() || len(url.Rules) > 0 || len(url.Variants) > 0 || targeting.DependsOnVisitor(url.UTM) {
+		// A cached redirect could outlive the window or reach visitors
+		// that other rules or variants apply to
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	if url.HasPassword() {
+		if !h.passwords.Unlocked(r, url) {
+			renderPasswordPage(w, r, http.StatusOK, "")
+			metrics.ObserveRedirect("locked", start)
+			return
+		}
+		// The destination is only for visitors who know the passphrase
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+
+	built, err := targeting.BuildDestination(destination, url, targeting.Visit{
+		PathSuffix: vars["rest"],
+		Query:      r.URL.Query(),
+		Values: map[string]string{
+			"short_code": shortCode,
+			"rule":       ruleID(rule),
+			"variant":    variantID(variant),
+			"platform":   visitor.Platform,
+			"country":    visitor.Country,
+		},
+	})
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to build destination", "short_code", shortCode, "error", err)
+		built = destination
+	}
+
+	// Screen where the visitor is actually sent, forwarded path and query
+	// included. Destinations can become known-bad after the link was
+	// created; disable the link so it stays down even if the verdict later
+	// changes. What a visitor appended only blocks their own redirect, so
+	// nobody can take someone else's link down with a crafted path.
+	if verdict := h.screen(r.Context(), built, "redirect"); verdict.Blocked {
+		if built != destination && !h.screen(r.Context(), destination, "redirect").Blocked {
+			renderPage(w, r, http.StatusForbidden, page{
+				Title:   "This destination is blocked",
+				Message: "The address this link would take you to was identified as unsafe.",
+				Detail:  verdict.Reason,
+			})
+			metrics.ObserveRedirect("blocked", start)
+			return
+		}
+
+		reason := "Destination identified as unsafe: " + verdict.Reason
+		ctx := auth.WithActor(r.Context(), auth.ActorSystem)
+		if disabled, err := setStatus(ctx, h.storage, h.audit, url.Key(), models.URLStatusDisabled, reason); err != nil {
+			slog.WarnContext(r.Context(), "Failed to disable blocked URL", "short_code", shortCode, "error", err)
+			blocked := *url
+			blocked.Status, blocked.StatusReason = models.URLStatusDisabled, reason
+			url = &blocked
+		} else {
+			url = disabled
+		}
+		renderStatusPage(w, r, url)
+		metrics.ObserveRedirect("blocked", start)
+		return
+	}
+	destination = built
+
+	c := click{
+		ShortCode:          shortCode,
+		Domain:             url.Domain,
+		Workspace:          url.Workspace,
+		DestinationVersion: url.CurrentVersion(),
+		Outcome:            clickAllowed,
+		RuleID:             ruleID(rule),
+		Variant:            variantID(variant),
+		UTM:                targeting.UTMFromURL(destination),
+		UserAgent:          r.UserAgent(),
+		Referrer:           r.Referer(),
+	}
+
+	if url.MaxClicks > 0 && r.Method == http.MethodHead {
+		// The Location would give the destination away without using up
+		// a click
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.WriteHeader(http.StatusOK)
+		metrics.ObserveRedirect("head", start)
+		return
+	}
+	if url.MaxClicks > 0 {
+		allowed, used, err := h.counter.ConsumeClick(r.Context(), url.Key(), url.MaxClicks)
+		if err != nil {
+			// Fail closed: a single-use link must never open twice
+			slog.ErrorContext(r.Context(), "Failed to count click", "short_code", shortCode, "error", err)
+			http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+			metrics.ObserveRedirect("error", start)
+			return
+		}
+		if !allowed {
+			c.Outcome = clickRejected
+			h.queueClick(r, c)
+			renderPage(w, r, http.StatusGone, page{
+				Title:   "This link has expired",
+				Message: "This short link has reached its maximum number of uses and no longer redirects.",
+			})
+			metrics.ObserveRedirect("exhausted", start)
+			return
+		}
+		slog.DebugContext(r.Context(), "Limited link used", "short_code", shortCode, "used", used, "max_clicks", url.MaxClicks)
+		// Every redirect has to reach the counter
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	// Only visits the link itself lets through count against the workspace
+	if r.Method != http.MethodHead && !h.allowMonthlyClick(w, r, url) {
+		if url.MaxClicks > 0 {
+			if err := h.counter.RefundClick(r.Context(), url.Key()); err != nil {
+				slog.WarnContext(r.Context(), "Failed to refund click", "short_code", shortCode, "error", err)
+			}
+		}
+		metrics.ObserveRedirect("quota", start)
 		return
 	}
 
-	// Track click asynchronously
-	go h.trackClick(shortCode, r.UserAgent(), r.Referer())
+	if r.Method != http.MethodHead {
+		h.queueClick(r, c)
+	}
 
-	http.Redirect(w, r, url.OriginalURL, http.StatusFound)
+	if variant != nil {
+		setVariantCookie(w, r, url, variant)
+	}
+	h.setRedirectCaching(w, url)
+	http.Redirect(w, r, destination, url.RedirectStatus())
+	metrics.ObserveRedirect("redirected", start)
+}
+
+// screen checks a destination with the configured screener. Redirects wait
+// at most screenTimeout for the verdict. Screening fails open:
+// failures and timeouts let the URL through.
+func (h *URLHandler) screen(ctx context.Context, destination, stage string) screening.Verdict {
+	if h.screener == nil {
+		return screening.Verdict{}
+	}
+	timeout := time.Duration(0)
+	if stage == "redirect" {
+		timeout = h.screenTimeout
+	}
+	verdict, err := screening.ScreenWithin(ctx, h.screener, destination, timeout)
+	if err != nil {
+		slog.WarnContext(ctx, "Destination screening failed", "stage", stage, "error", err)
+		return screening.Verdict{}
+	}
+	if verdict.Blocked {
+		slog.InfoContext(ctx, "Destination blocked", "stage", stage, "source", verdict.Source,
+			"reason", verdict.Reason, "url", destination)
+		metrics.DestinationBlocked(stage, verdict.Source)
+	}
+	return verdict
+}
+
+// Click outcomes reported to the analytics service
+const (
+	clickAllowed = "allowed"
+	// clickRejected is a visit refused because the link used up its clicks
+	clickRejected = "rejected"
+)
+
+// click is the event reported to the analytics service for a redirect
+type click struct {
+	ShortCode          string `json:"short_code"`
+	Domain             string `json:"domain,omitempty"`
+	Workspace          string `json:"workspace,omitempty"`
+	DestinationVersion int    `json:"destination_version"`
+	Outcome            string `json:"outcome"`
+	UserAgent          string `json:"user_agent"`
+	Referrer           string `json:"referrer"`
+	// RuleID names the redirect rule that chose the destination
+	RuleID string `json:"rule_id,omitempty"`
+	// Variant names the A/B variant the visitor was sent to
+	Variant string `json:"variant,omitempty"`
+	// UTM holds the campaign parameters of the final destination
+	UTM *models.UTM `json:"utm,omitempty"`
+}
+
+// queueClick tracks a click asynchronously; the delivery outlives the
+// request but stays part of its trace
+func (h *URLHandler) queueClick(r *http.Request, c click) {
+	metrics.ClickQueued()
+	h.clicks.Add(1)
+	go h.trackClick(context.WithoutCancel(r.Context()), c)
 }
 
 // trackClick sends a click event to the analytics service
-func (h *URLHandler) trackClick(shortCode, userAgent, referrer string) {
-	payload := map[string]string{
-		"short_code": shortCode,
-		"user_agent": userAgent,
-		"referrer":   referrer,
+func (h *URLHandler) trackClick(ctx context.Context, c click) {
+	defer h.clicks.Done()
+	defer metrics.ClickDone()
+
+	shortCode := models.LinkKey(c.Domain, c.ShortCode)
+	ctx, span := tracing.Tracer().Start(ctx, "trackClick",
+		trace.WithAttributes(attribute.String("short_code", shortCode)))
+	defer span.End()
+
+	jsonData, err := json.Marshal(c)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal track payload", "error", err)
+		metrics.ClickFailed("marshal")
+		return
 	}
 
-	jsonData, err := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.analyticsServiceURL+"/track", bytes.NewBuffer(jsonData))
 	if err != nil {
-		log.Printf("Failed to marshal track payload: %v", err)
+		slog.ErrorContext(ctx, "Failed to build track request", "error", err)
+		metrics.ClickFailed("request")
 		return
 	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.trackToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.trackToken)
+	}
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set(logging.RequestIDHeader, requestID)
+	}
 
-	resp, err := http.Post(
-		h.analyticsServiceURL+"/track",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	resp, err := h.client.Do(req)
 	if err != nil {
-		log.Printf("Failed to track click: %v", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "track request failed")
+		slog.WarnContext(ctx, "Failed to track click", "short_code", shortCode, "error", err)
+		metrics.ClickFailed("request")
 		return
 	}
 	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		slog.WarnContext(ctx, "Analytics service rejected click", "short_code", shortCode, "status", resp.StatusCode)
+		span.SetStatus(codes.Error, resp.Status)
+		metrics.ClickFailed("status")
+	}
 }
 
-// GetAllURLs handles GET /urls requests
+// Drain waits for click deliveries started by earlier redirects to finish,
+// giving up when ctx is done
+func (h *URLHandler) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.clicks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetAllURLs handles GET /urls requests; ?domain= lists only the links on
+// one domain, with an empty value for the default domain
 func (h *URLHandler) GetAllURLs(w http.ResponseWriter, r *http.Request) {
-	urls, err := h.storage.FindAll()
+	urls, err := h.storage.FindAll(r.Context())
 	if err != nil {
 		http.Error(w, "Failed to retrieve URLs", http.StatusInternalServerError)
 		return
 	}
 
+	filter := r.URL.Query().Has("domain")
+	domain := queryDomain(r)
+	listed := urls[:0]
+	for _, url := range urls {
+		if !filter || url.Domain == domain {
+			listed = append(listed, url.Redacted())
+		}
+	}
+	urls = listed
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(urls)
 }
 
+// PingAnalytics checks that the analytics service is reachable
+func (h *URLHandler) PingAnalytics(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.analyticsServiceURL+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("analytics service returned %s", resp.Status)
+	}
+	return nil
+}
+
 // HealthCheck handles GET /health requests
 func (h *URLHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"linkshort/pkg/logging"
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+	"url-service/screening"
+	"url-service/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTrackClickSendsToken(t *testing.T) {
+	var gotAuth string
+	var got click
+	analytics := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer analytics.Close()
+
+	t.Setenv("ANALYTICS_SERVICE_URL", analytics.URL)
+	t.Setenv("ANALYTICS_TRACK_TOKEN", "secret")
+	t.Setenv("PUBLIC_SHORT_URL_DOMAIN", "http://s.example.com")
+	h := NewURLHandler(storage.NewMemoryStorage(), URLHandlerOptions{})
+
+	h.clicks.Add(1)
+	h.trackClick(context.Background(), click{ShortCode: "abc123", Workspace: "acme"})
+
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the track token", gotAuth)
+	}
+	if got.Workspace != "acme" {
+		t.Errorf("workspace = %q, want acme", got.Workspace)
+	}
+}
+
+func TestDrainWaitsForInFlightClick(t *testing.T) {
+	delivered := make(chan string, 1)
+	release := make(chan struct{})
+	analytics := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- r.Header.Get(logging.RequestIDHeader)
+		<-release
+	}))
+	defer analytics.Close()
+	releaseOnce := sync.OnceFunc(func() { close(release) })
+	defer releaseOnce()
+	t.Setenv("ANALYTICS_SERVICE_URL", analytics.URL)
+
+	h, store := newTestHandler(t)
+	if err := store.Save(adminContext(), &models.URL{ShortCode: "drain", OriginalURL: "https://example.org/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/drain", nil), map[string]string{"shortCode": "drain"})
+	r.Header.Set(logging.RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	logging.RequestID(http.HandlerFunc(h.RedirectURL)).ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("redirect = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	// The click is delivered with the redirect's request ID and is now
+	// waiting on the analytics service
+	if id := <-delivered; id != "req-42" {
+		t.Errorf("click delivered with request ID %q, want req-42", id)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := h.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain with the click in flight = %v, want the deadline", err)
+	}
+
+	// The delivery finishing while Drain waits lets it return
+	time.AfterFunc(20*time.Millisecond, releaseOnce)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Drain(ctx); err != nil {
+		t.Fatalf("Drain = %v, want the in-flight click to finish", err)
+	}
+}
+
+// blockBad blocks destinations that contain "bad"
+type blockBad struct{}
+
+func (blockBad) Screen(ctx context.Context, rawURL string) (screening.Verdict, error) {
+	if strings.Contains(rawURL, "bad") {
+		return screening.Verdict{Blocked: true, Reason: "test", Source: "test"}, nil
+	}
+	return screening.Verdict{}, nil
+}
+
+func TestRedirectScreensBuiltDestination(t *testing.T) {
+	h, store := newTestHandler(t)
+	h.screener = blockBad{}
+	ctx := adminContext()
+	for _, url := range []*models.URL{
+		{ShortCode: "blocked", OriginalURL: "https://bad.example/"},
+		{ShortCode: "forward", OriginalURL: "https://example.com/", ForwardPath: true, ForwardQuery: true},
+	} {
+		if err := store.Save(ctx, url); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		vars       map[string]string
+		target     string
+		wantCode   int
+		wantActive bool
+	}{
+		{"blocked destination", map[string]string{"shortCode": "blocked"}, "/blocked", http.StatusGone, false},
+		{"blocked forwarded path", map[string]string{"shortCode": "forward", "rest": "bad"}, "/forward/bad", http.StatusForbidden, true},
+		{"blocked forwarded query", map[string]string{"shortCode": "forward"}, "/forward?next=bad", http.StatusForbidden, true},
+		{"clean visit", map[string]string{"shortCode": "forward", "rest": "ok"}, "/forward/ok", http.StatusFound, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodHead, tt.target, nil), tt.vars)
+			w := httptest.NewRecorder()
+			h.RedirectURL(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			stored, err := store.FindByShortCode(ctx, tt.vars["shortCode"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.IsActive() != tt.wantActive {
+				t.Errorf("link status = %q, want active %v", stored.Status, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestRedirectClickLimits(t *testing.T) {
+	h, store := newTestHandler(t)
+	workspaces, err := workspace.NewRegistry([]workspace.Workspace{{ID: "acme", MaxMonthlyClicks: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.counter, h.quotas, h.workspaces = store, store, workspaces
+
+	ctx := adminContext()
+	if err := h.domains.Add(ctx, &models.Domain{Host: "go.acme.test", Scheme: "https", Workspace: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	acme := workspace.NewContext(ctx, "acme")
+	for _, url := range []*models.URL{
+		{ShortCode: "once", Domain: "go.acme.test", Workspace: "acme", OriginalURL: "https://example.com/", MaxClicks: 1},
+		{ShortCode: "twice", Domain: "go.acme.test", Workspace: "acme", OriginalURL: "https://example.com/", MaxClicks: 2},
+	} {
+		if err := store.Save(acme, url); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	visit := func(method, shortCode string) int {
+		t.Helper()
+		r := httptest.NewRequest(method, "https://go.acme.test/"+shortCode, nil)
+		r = mux.SetURLVars(r, map[string]string{"shortCode": shortCode})
+		w := httptest.NewRecorder()
+		h.RedirectURL(w, r)
+		return w.Code
+	}
+
+	// HEAD neither uses up a click nor the monthly quota
+	if code := visit(http.MethodHead, "once"); code != http.StatusOK {
+		t.Errorf("HEAD = %d, want %d", code, http.StatusOK)
+	}
+	if code := visit(http.MethodGet, "once"); code != http.StatusFound {
+		t.Fatalf("first visit = %d, want %d", code, http.StatusFound)
+	}
+	// An exhausted link answers 410 without using the monthly quota
+	for range 3 {
+		if code := visit(http.MethodGet, "once"); code != http.StatusGone {
+			t.Fatalf("visit of a used-up link = %d, want %d", code, http.StatusGone)
+		}
+	}
+	if code := visit(http.MethodGet, "twice"); code != http.StatusFound {
+		t.Fatalf("visit within the monthly quota = %d, want %d", code, http.StatusFound)
+	}
+
+	// Past the monthly quota the click counted against the link is given back
+	if code := visit(http.MethodGet, "twice"); code != http.StatusTooManyRequests {
+		t.Fatalf("visit past the monthly quota = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if allowed, used, _ := store.ConsumeClick(acme, models.LinkKey("go.acme.test", "twice"), 2); !allowed || used != 2 {
+		t.Errorf("link clicks after a refused visit = %v, %d used; want one left", allowed, used)
+	}
+}
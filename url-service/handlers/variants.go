@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"url-service/auth"
+	"url-service/models"
+	"url-service/targeting"
+)
+
+const (
+	variantCookieName = "linkshort_variant"
+	variantCookieTTL  = 30 * 24 * time.Hour
+)
+
+// checkVariants validates an A/B split and its destinations, answering the
+// request itself when one is rejected
+func (h *URLHandler) checkVariants(w http.ResponseWriter, r *http.Request, variants []models.Variant, stage string) bool {
+	if err := targeting.NormalizeVariants(variants); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	for i := range variants {
+		destination, ok := h.checkDestination(w, r, variants[i].Destination, stage)
+		if !ok {
+			return false
+		}
+		variants[i].Destination = destination
+	}
+	return true
+}
+
+// chooseVariant returns the visitor's variant of url. A variant cookie from
+// an earlier visit wins; otherwise the visitor is assigned by a hash of
+// their IP and User-Agent, so they stay on one variant even without cookies.
+func chooseVariant(r *http.Request, url *models.URL) *models.Variant {
+	if cookie, err := r.Cookie(variantCookieName); err == nil {
+		if variant := targeting.FindVariant(url.Variants, cookie.Value); variant != nil {
+			return variant
+		}
+	}
+	visitor := auth.PrincipalFromContext(r.Context()).IP + "\x00" + r.UserAgent()
+	return targeting.AssignVariant(url.Variants, url.ScopedKey(), visitor)
+}
+
+// setVariantCookie remembers the visitor's variant for the link
+func setVariantCookie(w http.ResponseWriter, r *http.Request, url *models.URL, variant *models.Variant) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookieName,
+		Value:    variant.ID,
+		Path:     "/" + url.ShortCode,
+		MaxAge:   int(variantCookieTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// variantID names the variant that was chosen, or "" when there was none
+func variantID(variant *models.Variant) string {
+	if variant == nil {
+		return ""
+	}
+	return variant.ID
+}
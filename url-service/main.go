@@ -1,31 +1,40 @@
 package main
 
 import (
-	"log"
+	"context"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"linkshort/pkg/health"
+	"linkshort/pkg/logging"
+	httpmetrics "linkshort/pkg/metrics"
+	"linkshort/pkg/middleware"
+	"linkshort/pkg/ratelimit"
+	"linkshort/pkg/redisconfig"
+	"linkshort/pkg/workspace"
+
+	"url-service/audit"
+	"url-service/auth"
+	"url-service/domains"
 	"url-service/handlers"
+	"url-service/metrics"
+	"url-service/password"
+	"url-service/screening"
 	"url-service/storage"
+	"url-service/targeting"
+	"url-service/tracing"
+	"url-service/validation"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func initStorage() storage.URLStorage {
 	storageType := os.Getenv("STORAGE_TYPE")
 	redisURL := os.Getenv("REDIS_URL")
@@ -34,38 +43,320 @@ func initStorage() storage.URLStorage {
 		if redisURL == "" {
 			redisURL = "localhost:6379"
 		}
-		log.Printf("Initializing Redis storage at %s", redisURL)
-		store, err := storage.NewRedisStorage(redisURL)
+		opts, err := redisconfig.OptionsFromEnv(redisURL)
+		if err != nil {
+			slog.Warn("Invalid Redis configuration, falling back to memory storage", "error", err)
+			return storage.NewMemoryStorage()
+		}
+		slog.Info("Initializing Redis storage", "addrs", strings.Join(opts.Addrs, ","))
+		store, err := storage.NewRedisStorage(opts)
 		if err != nil {
-			log.Printf("Failed to connect to Redis: %v, falling back to memory storage", err)
+			slog.Warn("Failed to connect to Redis, falling back to memory storage", "error", err)
 			return storage.NewMemoryStorage()
 		}
-		log.Println("Redis storage initialized successfully")
+		slog.Info("Redis storage initialized successfully")
 		return store
 	}
 
-	log.Println("Using in-memory storage")
+	slog.Info("Using in-memory storage")
 	return storage.NewMemoryStorage()
 }
 
+// migrateKeys moves links stored before their keys carried hash tags to
+// the current names
+func migrateKeys(store storage.URLStorage, workspaces *workspace.Registry) {
+	redisStore, ok := store.(*storage.RedisStorage)
+	if !ok {
+		return
+	}
+	renamed, err := redisStore.MigrateLinkKeys(context.Background(), workspaces.IDs())
+	if err != nil {
+		slog.Error("Failed to migrate Redis keys", "error", err)
+		os.Exit(1)
+	}
+	if renamed > 0 {
+		slog.Info("Migrated Redis keys to per-link hash tags", "keys", renamed)
+	}
+}
+
+// newLimiterBackend shares token buckets through Redis when it is the
+// storage backend, otherwise limits apply per replica
+func newLimiterBackend(store storage.URLStorage) (ratelimit.Limiter, string) {
+	if redisStore, ok := store.(*storage.RedisStorage); ok {
+		return ratelimit.NewRedisLimiter(redisStore.Client()), "redis"
+	}
+	return ratelimit.NewMemoryLimiter(), "memory"
+}
+
+// initRateLimiter returns nil when rate limiting is disabled
+func initRateLimiter(store storage.URLStorage, workspaces *workspace.Registry) *ratelimit.RateLimiter {
+	cfg, err := ratelimit.ConfigFromEnv(map[string]ratelimit.Policy{
+		"create": {
+			Anonymous: ratelimit.Rule{Rate: 1, Burst: 10},
+			Keyed:     ratelimit.Rule{Rate: 10, Burst: 50},
+		},
+		"redirect": {
+			Anonymous: ratelimit.Rule{Rate: 50, Burst: 100},
+			Keyed:     ratelimit.Rule{Rate: 200, Burst: 400},
+		},
+		"stats": {
+			Anonymous: ratelimit.Rule{Rate: 5, Burst: 20},
+			Keyed:     ratelimit.Rule{Rate: 20, Burst: 50},
+		},
+		"report": {
+			Anonymous: ratelimit.Rule{Rate: 0.1, Burst: 5},
+			Keyed:     ratelimit.Rule{Rate: 1, Burst: 20},
+		},
+	})
+	if err != nil {
+		slog.Error("Invalid rate limit configuration", "error", err)
+		os.Exit(1)
+	}
+	if !cfg.Enabled {
+		slog.Info("Rate limiting disabled")
+		return nil
+	}
+	// Workspace keys and the admin key are as much known clients as those in
+	// API_KEYS
+	for key := range workspaces.Keys() {
+		cfg.APIKeys = append(cfg.APIKeys, key)
+	}
+	if adminKey := os.Getenv("ADMIN_API_KEY"); adminKey != "" {
+		cfg.APIKeys = append(cfg.APIKeys, adminKey)
+	}
+
+	limiter, backend := newLimiterBackend(store)
+	slog.Info("Rate limiting enabled", "backend", backend)
+	return ratelimit.New(limiter, cfg)
+}
+
+// initPasswords sets up passphrase checks for protected links. Guesses are
+// always throttled, even when rate limiting is disabled.
+func initPasswords(store storage.URLStorage) *password.Guard {
+	opts, err := password.OptionsFromEnv()
+	if err != nil {
+		slog.Error("Invalid link password configuration", "error", err)
+		os.Exit(1)
+	}
+	limiter, _ := newLimiterBackend(store)
+	return password.NewGuard(limiter, opts)
+}
+
+// initDomains loads the registry of branded short domains
+func initDomains(store storage.DomainStorage, closers *[]io.Closer) *domains.Registry {
+	opts, err := domains.OptionsFromEnv()
+	if err != nil {
+		slog.Error("Invalid domain configuration", "error", err)
+		os.Exit(1)
+	}
+	registry, err := domains.NewRegistry(store, opts)
+	if err != nil {
+		slog.Error("Failed to load domain registry", "error", err)
+		os.Exit(1)
+	}
+	*closers = append(*closers, registry)
+	return registry
+}
+
+// initScreener loads the destination blocklists and lookup service, or
+// returns nil when none are configured, along with how long redirects wait
+// for a verdict
+func initScreener(closers *[]io.Closer) (screening.DestinationScreener, time.Duration) {
+	opts, err := screening.OptionsFromEnv()
+	if err != nil {
+		slog.Error("Invalid screening configuration", "error", err)
+		os.Exit(1)
+	}
+
+	chain, err := screening.New(opts)
+	if err != nil {
+		slog.Error("Failed to load destination blocklist", "error", err)
+		os.Exit(1)
+	}
+	if len(chain) == 0 {
+		slog.Info("Destination screening disabled")
+		return nil, 0
+	}
+
+	slog.Info("Destination screening enabled", "screeners", len(chain), "redirect_timeout", opts.RedirectTimeout)
+	*closers = append(*closers, chain)
+	return chain, opts.RedirectTimeout
+}
+
+// initBloom puts a Bloom filter in front of a shared storage backend so
+// lookups for unknown short codes never reach it
+func initBloom(store storage.URLStorage, workspaces *workspace.Registry, closers *[]io.Closer) storage.URLStorage {
+	if os.Getenv("BLOOM_ENABLED") == "false" {
+		slog.Info("Bloom filter disabled")
+		return store
+	}
+
+	opts, err := storage.BloomOptionsFromEnv()
+	if err != nil {
+		slog.Warn("Invalid Bloom filter configuration, running without filter", "error", err)
+		return store
+	}
+	opts.Workspaces = workspaces.IDs()
+
+	bloom, err := storage.NewBloomStorage(store, opts)
+	if err != nil {
+		slog.Warn("Failed to build Bloom filter, running without filter", "error", err)
+		return store
+	}
+	metrics.RegisterBloom(bloom.Stats)
+	*closers = append(*closers, bloom)
+	slog.Info("Bloom filter loaded", "short_codes", bloom.Stats().Items)
+	return bloom
+}
+
+// initCache puts an in-process cache in front of a shared storage backend
+func initCache(store storage.URLStorage, closers *[]io.Closer) storage.URLStorage {
+	opts, err := storage.CacheOptionsFromEnv()
+	if err != nil {
+		slog.Warn("Invalid cache configuration, running without cache", "error", err)
+		return store
+	}
+	if opts.Size <= 0 {
+		slog.Info("URL cache disabled")
+		return store
+	}
+
+	cached, err := storage.NewCachedStorage(store, opts)
+	if err != nil {
+		slog.Warn("Failed to subscribe to URL changes, running without cache", "error", err)
+		return store
+	}
+	slog.Info("URL cache enabled", "size", opts.Size, "ttl", opts.TTL, "negative_ttl", opts.NegativeTTL)
+	*closers = append(*closers, cached)
+	return cached
+}
+
 func main() {
+	if err := logging.Setup("url-service"); err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize tracing before anything that creates spans
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+
+	workspaces, err := workspace.RegistryFromEnv()
+	if err != nil {
+		slog.Error("Invalid workspace configuration", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize storage based on STORAGE_TYPE environment variable
 	store := initStorage()
+	migrateKeys(store, workspaces)
+	reports, _ := store.(storage.ReportStorage)
+	auditStore, _ := store.(storage.AuditStorage)
+	history, _ := store.(storage.HistoryStorage)
+	counter, _ := store.(storage.ClickCounter)
+	domainStore, _ := store.(storage.DomainStorage)
+	quotas, _ := store.(storage.QuotaCounter)
+	auditLog := audit.NewLogger(auditStore)
+	limiter := initRateLimiter(store, workspaces)
+	passwords := initPasswords(store)
+	middleware.TrustProxyHeaders = os.Getenv("TRUST_PROXY_HEADERS") == "true"
+	if header := os.Getenv("COUNTRY_HEADER"); header != "" {
+		targeting.CountryHeader = header
+	}
+
+	// Everything holding connections or goroutines, closed in reverse order
+	var closers []io.Closer
+	if closer, ok := store.(io.Closer); ok {
+		closers = append(closers, closer)
+	}
+
+	// Only shared backends need the Bloom filter and cache; in-memory storage
+	// is already local to this replica
+	backend := "memory"
+	_, shared := store.(storage.ChangeSubscriber)
+	if shared {
+		backend = "redis"
+	}
+	store = metrics.InstrumentStorage(store, backend)
+	if shared {
+		store = initCache(initBloom(store, workspaces, &closers), &closers)
+	}
+	store = tracing.TraceStorage(store)
 
 	// Initialize handlers
-	urlHandler := handlers.NewURLHandler(store)
+	validatorOpts, err := validation.OptionsFromEnv()
+	if err != nil {
+		slog.Error("Invalid URL validation configuration", "error", err)
+		os.Exit(1)
+	}
+	redirectOpts, err := handlers.RedirectOptionsFromEnv()
+	if err != nil {
+		slog.Error("Invalid redirect configuration", "error", err)
+		os.Exit(1)
+	}
+	registry := initDomains(domainStore, &closers)
+	screener, screenTimeout := initScreener(&closers)
+	urlHandler := handlers.NewURLHandler(store, handlers.URLHandlerOptions{
+		History:               history,
+		Counter:               counter,
+		Validator:             validation.NewURLValidator(validatorOpts),
+		Screener:              screener,
+		RedirectScreenTimeout: screenTimeout,
+		Audit:                 auditLog,
+		Passwords:             passwords,
+		Redirects:             redirectOpts,
+		Domains:               registry,
+		Workspaces:            workspaces,
+		Quotas:                quotas,
+	})
+	moderationHandler := handlers.NewModerationHandler(store, reports, registry, auditLog)
+	auditHandler := handlers.NewAuditHandler(auditStore)
+	domainHandler := handlers.NewDomainHandler(registry, store, workspaces, auditLog)
+	authn := auth.AuthenticatorFromEnv(workspaces)
+	var checks []health.DependencyCheck
+	if pinger, ok := store.(storage.Pinger); ok {
+		checks = append(checks, health.DependencyCheck{Name: "storage", Critical: true, Check: pinger.Ping})
+	} else {
+		slog.Warn("Storage cannot be pinged, readiness does not check it")
+	}
+	// Redirects keep working without analytics, so it only degrades readiness
+	checks = append(checks, health.DependencyCheck{Name: "analytics", Check: urlHandler.PingAnalytics})
+	healthHandler := health.NewHandler(checks...)
 
 	// Setup router
 	r := mux.NewRouter()
 
 	// Routes
 	r.HandleFunc("/health", urlHandler.HealthCheck).Methods("GET")
-	r.HandleFunc("/shorten", urlHandler.CreateShortURL).Methods("POST", "OPTIONS")
-	r.HandleFunc("/urls", urlHandler.GetAllURLs).Methods("GET", "OPTIONS")
-	r.HandleFunc("/{shortCode}", urlHandler.RedirectURL).Methods("GET")
+	r.HandleFunc("/healthz", healthHandler.Liveness).Methods("GET")
+	r.HandleFunc("/readyz", healthHandler.Readiness).Methods("GET")
+	r.Handle("/shorten", limiter.Limit("create", urlHandler.CreateShortURL)).Methods("POST", "OPTIONS")
+	r.Handle("/urls", limiter.Limit("stats", urlHandler.GetAllURLs)).Methods("GET", "OPTIONS")
+	r.Handle("/urls/{shortCode}", limiter.Limit("create", urlHandler.UpdateURL)).Methods("PUT", "OPTIONS")
+	r.Handle("/urls/{shortCode}/history", limiter.Limit("stats", urlHandler.GetHistory)).Methods("GET", "OPTIONS")
+	r.Handle("/urls/{shortCode}/rollback/{version}", limiter.Limit("create", urlHandler.RollbackURL)).Methods("POST", "OPTIONS")
+	r.Handle("/report/{shortCode}", limiter.Limit("report", moderationHandler.ReportURL)).Methods("POST", "OPTIONS")
+	r.Handle("/admin/reports", authn.RequireAdmin(moderationHandler.ListReports)).Methods("GET", "OPTIONS")
+	r.Handle("/admin/reports/{id}/resolve", authn.RequireAdmin(moderationHandler.ResolveReport)).Methods("POST", "OPTIONS")
+	r.Handle("/admin/urls/{shortCode}/status", authn.RequireAdmin(moderationHandler.UpdateStatus)).Methods("PUT", "OPTIONS")
+	r.Handle("/admin/domains", authn.RequireAdmin(domainHandler.ListDomains)).Methods("GET", "OPTIONS")
+	r.Handle("/admin/domains", authn.RequireAdmin(domainHandler.CreateDomain)).Methods("POST", "OPTIONS")
+	r.Handle("/admin/domains/{host}", authn.RequireAdmin(domainHandler.DeleteDomain)).Methods("DELETE", "OPTIONS")
+	r.Handle("/audit", authn.RequireAdmin(auditHandler.GetAudit)).Methods("GET", "OPTIONS")
+	r.Handle("/{shortCode}", limiter.Limit("redirect", urlHandler.RedirectURL)).Methods("GET", "HEAD")
+	r.Handle("/{shortCode}", limiter.Limit("redirect", urlHandler.UnlockURL)).Methods("POST")
+	r.Handle("/{shortCode}/{rest:.+}", limiter.Limit("redirect", urlHandler.RedirectURL)).Methods("GET", "HEAD")
+	r.Handle("/{shortCode}/{rest:.+}", limiter.Limit("redirect", urlHandler.UnlockURL)).Methods("POST")
+	r.Use(otelmux.Middleware(tracing.ServiceName), logging.RouteTemplate)
 
-	// Apply CORS middleware
-	handler := corsMiddleware(r)
+	// Count every request the router sees, including unmatched ones, identify
+	// the caller, apply CORS middleware, then request IDs and access logging
+	// around everything
+	cors := middleware.NewCORS(middleware.CORSConfigFromEnv())
+	handler := logging.RequestID(logging.AccessLog(cors.Handler(authn.Identify(httpmetrics.Instrument(r)))))
 
 	// Get port from environment or default
 	port := os.Getenv("PORT")
@@ -73,8 +364,79 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("URL Service starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: envDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       envDuration("HTTP_READ_TIMEOUT", 10*time.Second),
+		WriteTimeout:      envDuration("HTTP_WRITE_TIMEOUT", 10*time.Second),
+		IdleTimeout:       envDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+	}
+
+	// Metrics are served on a port of their own that is never exposed publicly
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9090"
+	}
+	metricsSrv := httpmetrics.NewServer(":" + metricsPort)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		slog.Info("URL Service starting", "port", port)
+		serverErr <- srv.ListenAndServe()
+	}()
+	go func() {
+		slog.Info("Metrics listening", "port", metricsPort)
+		serverErr <- metricsSrv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		slog.Error("Failed to start server", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Stop accepting requests, let in-flight ones finish, then wait for the
+	// click deliveries they started before closing storage
+	shutdownTimeout := envDuration("SHUTDOWN_TIMEOUT", 20*time.Second)
+	slog.Info("Shutting down", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	healthHandler.SetDraining()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("HTTP server did not drain in time", "error", err)
+	}
+	metricsSrv.Shutdown(shutdownCtx)
+	if err := urlHandler.Drain(shutdownCtx); err != nil {
+		slog.Warn("Abandoning undelivered clicks", "error", err)
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			slog.Warn("Failed to close storage", "error", err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+	slog.Info("URL Service stopped")
+}
+
+// envDuration reads a duration such as "15s" from the environment
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid duration", "key", key, "value", value)
+		return fallback
 	}
+	return d
 }
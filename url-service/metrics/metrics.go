@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "linkshort"
+
+var (
+	redirectDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redirect_duration_seconds",
+		Help:      "Time from receiving a short code to answering the redirect, by outcome.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"outcome"})
+
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Storage operation latency by backend and operation.",
+		Buckets:   []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"backend", "operation"})
+
+	storageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_errors_total",
+		Help:      "Failed storage operations by backend and operation.",
+	}, []string{"backend", "operation"})
+
+	clickQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "click_tracking_in_flight",
+		Help:      "Click events waiting to be delivered to the analytics service.",
+	})
+
+	clickFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "click_tracking_failures_total",
+		Help:      "Click events that could not be delivered to the analytics service, by reason.",
+	}, []string{"reason"})
+
+	destinationsBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "destinations_blocked_total",
+		Help:      "Destinations rejected by screening, by stage (create or redirect) and source.",
+	}, []string{"stage", "source"})
+)
+
+// ObserveRedirect records how long a redirect took and how it ended
+func ObserveRedirect(outcome string, start time.Time) {
+	redirectDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
+
+// ClickQueued marks a click event as waiting for delivery
+func ClickQueued() {
+	clickQueueDepth.Inc()
+}
+
+// ClickDone marks a click event as delivered or abandoned
+func ClickDone() {
+	clickQueueDepth.Dec()
+}
+
+// ClickFailed counts a click event that could not be delivered
+func ClickFailed(reason string) {
+	clickFailures.WithLabelValues(reason).Inc()
+}
+
+// DestinationBlocked counts a destination rejected by screening
+func DestinationBlocked(stage, source string) {
+	destinationsBlocked.WithLabelValues(stage, source).Inc()
+}
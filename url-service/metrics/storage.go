@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"url-service/models"
+	"url-service/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// InstrumentedStorage is a URLStorage decorator that records latency and
+// errors for every call to the wrapped backend
+type InstrumentedStorage struct {
+	next    storage.URLStorage
+	backend string
+}
+
+// InstrumentStorage wraps a backend, labelling its metrics with the backend name
+func InstrumentStorage(next storage.URLStorage, backend string) *InstrumentedStorage {
+	return &InstrumentedStorage{next: next, backend: backend}
+}
+
+func (s *InstrumentedStorage) observe(operation string, start time.Time, err error) {
+	storageDuration.WithLabelValues(s.backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, storage.ErrURLNotFound) && !errors.Is(err, storage.ErrURLConflict) {
+		storageErrors.WithLabelValues(s.backend, operation).Inc()
+	}
+}
+
+// Save stores a URL
+func (s *InstrumentedStorage) Save(ctx context.Context, url *models.URL) error {
+	start := time.Now()
+	err := s.next.Save(ctx, url)
+	s.observe("save", start, err)
+	return err
+}
+
+// Replace swaps a stored URL
+func (s *InstrumentedStorage) Replace(ctx context.Context, current, updated *models.URL) error {
+	start := time.Now()
+	err := s.next.Replace(ctx, current, updated)
+	s.observe("replace", start, err)
+	return err
+}
+
+// FindByShortCode retrieves a URL by its short code
+func (s *InstrumentedStorage) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	start := time.Now()
+	url, err := s.next.FindByShortCode(ctx, shortCode)
+	s.observe("find_by_short_code", start, err)
+	return url, err
+}
+
+// FindAll retrieves all stored URLs
+func (s *InstrumentedStorage) FindAll(ctx context.Context) ([]*models.URL, error) {
+	start := time.Now()
+	urls, err := s.next.FindAll(ctx)
+	s.observe("find_all", start, err)
+	return urls, err
+}
+
+// Exists checks if a short code already exists
+func (s *InstrumentedStorage) Exists(ctx context.Context, shortCode string) bool {
+	start := time.Now()
+	exists := s.next.Exists(ctx, shortCode)
+	s.observe("exists", start, nil)
+	return exists
+}
+
+// SubscribeChanges forwards to the backend so decorators stacked on top
+// still see changes from other replicas
+func (s *InstrumentedStorage) SubscribeChanges(onChange func(shortCode string), onResubscribe func()) (func(), error) {
+	if subscriber, ok := s.next.(storage.ChangeSubscriber); ok {
+		return subscriber.SubscribeChanges(onChange, onResubscribe)
+	}
+	return func() {}, nil
+}
+
+// RegisterBloom exposes Bloom filter effectiveness counters
+func RegisterBloom(stats func() storage.BloomStats) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bloom_items",
+		Help:      "Short codes inserted into the Bloom filter since its last rebuild.",
+	}, func() float64 { return float64(stats().Items) })
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bloom_checks_total",
+		Help:      "Short code lookups answered through the Bloom filter.",
+	}, func() float64 { return float64(stats().Checks) })
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bloom_definite_misses_total",
+		Help:      "Lookups rejected by the Bloom filter without reaching storage.",
+	}, func() float64 { return float64(stats().DefiniteMisses) })
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bloom_false_positives_total",
+		Help:      "Lookups the Bloom filter let through for codes that did not exist.",
+	}, func() float64 { return float64(stats().FalsePositives) })
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bloom_estimated_false_positive_rate",
+		Help:      "False-positive probability estimated from the filter fill ratio.",
+	}, func() float64 { return stats().EstimatedFPRate })
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bloom_resyncing",
+		Help:      "1 while the Bloom filter is rebuilt after a dropped change subscription.",
+	}, func() float64 {
+		if stats().Resyncing {
+			return 1
+		}
+		return 0
+	})
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditURLCreate     = "url.create"
+	AuditURLUpdate     = "url.update"
+	AuditURLRollback   = "url.rollback"
+	AuditURLStatus     = "url.status"
+	AuditReportCreate  = "report.create"
+	AuditReportResolve = "report.resolve"
+	AuditDomainCreate  = "domain.create"
+	AuditDomainDelete  = "domain.delete"
+)
+
+// AuditEntry records one mutation: who made it, from where, and the state
+// of the changed object before and after. ShortCode holds the link's key,
+// which for links on a registered domain is prefixed with the domain.
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Workspace string          `json:"workspace,omitempty"`
+	ShortCode string          `json:"short_code,omitempty"`
+	Domain    string          `json:"domain,omitempty"`
+	ReportID  string          `json:"report_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	// Cursor is the entry's position in the log, set when reading. Passed
+	// as AuditQuery.Before it continues after this entry.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// AuditQuery filters audit entries; zero fields match everything except
+// Workspace, which always applies
+type AuditQuery struct {
+	Workspace string
+	ShortCode string
+	Actor     string
+	From      time.Time
+	To        time.Time
+	// Before is the cursor of an earlier page's last entry; only older
+	// entries match
+	Before string
+	Limit  int
+}
+
+// Matches reports whether entry passes the filter
+func (q AuditQuery) Matches(entry *AuditEntry) bool {
+	if entry.Workspace != q.Workspace {
+		return false
+	}
+	if q.ShortCode != "" && entry.ShortCode != q.ShortCode {
+		return false
+	}
+	if q.Actor != "" && entry.Actor != q.Actor {
+		return false
+	}
+	if !q.From.IsZero() && entry.Timestamp.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && entry.Timestamp.After(q.To) {
+		return false
+	}
+	return true
+}
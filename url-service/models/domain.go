@@ -0,0 +1,52 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Domain is a branded short domain registered with the service. Links
+// created on it are reachable only through its host.
+type Domain struct {
+	// Host is the lower-case host name, without scheme or port
+	Host string `json:"host"`
+	// Scheme is what the domain's short URLs start with, https or http
+	Scheme string `json:"scheme"`
+	// Workspace owns the domain and every link on it, empty for the default
+	// workspace
+	Workspace string    `json:"workspace,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShortURL returns the public URL of a short code on the domain
+func (d *Domain) ShortURL(shortCode string) string {
+	return d.Scheme + "://" + d.Host + "/" + shortCode
+}
+
+// CreateDomainRequest is the request body for registering a domain
+type CreateDomainRequest struct {
+	Host string `json:"host"`
+	// Scheme defaults to https
+	Scheme string `json:"scheme,omitempty"`
+	// Workspace defaults to the default workspace
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// LinkKey identifies a link in storage. Short codes are unique per domain,
+// so links on a registered domain are keyed "<domain>/<code>"; links on the
+// default domain keep their bare code, as they were stored before domains
+// existed.
+func LinkKey(domain, shortCode string) string {
+	if domain == "" {
+		return shortCode
+	}
+	return domain + "/" + shortCode
+}
+
+// SplitLinkKey is the inverse of LinkKey
+func SplitLinkKey(key string) (domain, shortCode string) {
+	if domain, shortCode, found := strings.Cut(key, "/"); found {
+		return domain, shortCode
+	}
+	return "", key
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Report statuses
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusDismissed = "dismissed"
+	ReportStatusActioned  = "actioned"
+)
+
+// Report is an abuse report about a short link, waiting in or resolved from
+// the review queue
+type Report struct {
+	ID        string    `json:"id"`
+	ShortCode string    `json:"short_code"`
+	Domain    string    `json:"domain,omitempty"`
+	Workspace string    `json:"workspace,omitempty"`
+	Reason    string    `json:"reason"`
+	Details   string    `json:"details,omitempty"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	// Resolution is the moderator's note when the report was closed
+	Resolution string     `json:"resolution,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// CreateReportRequest is the request body for reporting a link
+type CreateReportRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+// ResolveReportRequest is the request body for closing a report. Action is
+// "dismiss", or "disable" / "ban" to also change the link's status.
+type ResolveReportRequest struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
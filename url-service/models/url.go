@@ -1,6 +1,27 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"linkshort/pkg/workspace"
+)
+
+// URL statuses. Links stored before statuses existed have none and count as
+// active.
+const (
+	URLStatusActive   = "active"
+	URLStatusDisabled = "disabled"
+	URLStatusBanned   = "banned"
+)
+
+// Schedule states of a link relative to its activation window
+const (
+	SchedulePending = "pending"
+	ScheduleLive    = "live"
+	ScheduleEnded   = "ended"
+)
 
 // URL represents a shortened URL entity
 type URL struct {
@@ -8,16 +29,336 @@ type URL struct {
 	ShortCode   string    `json:"short_code"`
 	OriginalURL string    `json:"original_url"`
 	CreatedAt   time.Time `json:"created_at"`
+	Status      string    `json:"status,omitempty"`
+	// Domain is the registered domain the link lives on, empty for the
+	// default domain
+	Domain string `json:"domain,omitempty"`
+	// Workspace owns the link, empty for the default workspace
+	Workspace string `json:"workspace,omitempty"`
+	// StatusReason explains why a link was disabled or banned
+	StatusReason    string     `json:"status_reason,omitempty"`
+	StatusUpdatedAt *time.Time `json:"status_updated_at,omitempty"`
+	// Version counts destination changes, starting at 1. Links stored before
+	// versioning have 0 and are treated as version 1.
+	Version int `json:"version,omitempty"`
+	// Owner is the actor that created the link; owners and admins may edit it
+	Owner string `json:"owner,omitempty"`
+	// PasswordHash is the bcrypt hash of the passphrase visitors must enter.
+	// It is stored with the link but never returned by the API.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// PasswordProtected tells API clients the link has a passphrase; it is
+	// set by Redacted
+	PasswordProtected bool `json:"password_protected,omitempty"`
+	// MaxClicks is how many times the link redirects before it expires;
+	// 0 means unlimited
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// ActiveFrom and ActiveUntil bound when the link redirects; either may
+	// be nil for an open-ended window
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	// FallbackURL receives visitors outside the activation window
+	FallbackURL string `json:"fallback_url,omitempty"`
+	// Rules send matching visitors elsewhere; the first match wins and
+	// visitors matching none go to OriginalURL
+	Rules []RedirectRule `json:"rules,omitempty"`
+	// Variants split visitors no rule matched between weighted
+	// destinations, replacing OriginalURL while set
+	Variants []Variant `json:"variants,omitempty"`
+	// UTM parameters are added to the destination's query string
+	UTM *UTM `json:"utm,omitempty"`
+	// ForwardQuery passes the query string of the visit on to the
+	// destination, and ForwardPath anything after the short code in the path
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	ForwardPath  bool `json:"forward_path,omitempty"`
+	// RedirectCode is the status visitors are redirected with: 301, 302,
+	// 307 or 308. 0 means 302.
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// Robots is the X-Robots-Tag sent with the link's responses, overriding
+	// the service default
+	Robots string `json:"robots,omitempty"`
+	// Revision counts the changes stored since the link was created, so a
+	// writer can tell whether someone else changed it after it was read
+	Revision int `json:"revision,omitempty"`
+}
+
+// UTM holds the campaign parameters of a destination. As a link template,
+// values may contain the placeholders {short_code}, {rule}, {variant},
+// {platform} and {country}, filled in for each visit.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// IsZero reports whether no parameter is set
+func (u *UTM) IsZero() bool {
+	return u == nil || *u == UTM{}
+}
+
+// Variant is one destination of an A/B split. Each visitor gets a variant
+// with probability Weight / sum of all weights and keeps it on later visits.
+type Variant struct {
+	ID          string `json:"id"`
+	Destination string `json:"destination"`
+	Weight      int    `json:"weight"`
+}
+
+// RedirectRule sends visitors matching every set condition to Destination.
+// Each condition lists alternatives, so Platforms ["ios", "android"] matches
+// visitors on either.
+type RedirectRule struct {
+	ID          string     `json:"id"`
+	Platforms   []string   `json:"platforms,omitempty"`
+	Countries   []string   `json:"countries,omitempty"`
+	Languages   []string   `json:"languages,omitempty"`
+	Hours       *TimeOfDay `json:"hours,omitempty"`
+	Destination string     `json:"destination"`
+}
+
+// TimeOfDay is a daily window from Start to End, as "15:04" in TimeZone
+// (UTC by default). A window ending before it starts wraps past midnight.
+type TimeOfDay struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// Key returns the link's storage key, see LinkKey
+func (u *URL) Key() string {
+	return LinkKey(u.Domain, u.ShortCode)
+}
+
+// ScopedKey is Key qualified by the owning workspace, unique across all
+// workspaces even where they share a short code
+func (u *URL) ScopedKey() string {
+	return workspace.KeyPrefix(u.Workspace) + u.Key()
+}
+
+// CurrentVersion returns the link's version, counting unversioned links as 1
+func (u *URL) CurrentVersion() int {
+	return max(u.Version, 1)
+}
+
+// RestoreFrom copies the destination and metadata kept in version history
+// from a snapshot, leaving the access controls RestoreAccessFrom copies
+// alone. Rules and variants are copied too, so normalizing the restored ones
+// leaves the snapshot alone.
+func (u *URL) RestoreFrom(snapshot *URL) {
+	u.OriginalURL = snapshot.OriginalURL
+	u.ActiveFrom = snapshot.ActiveFrom
+	u.ActiveUntil = snapshot.ActiveUntil
+	u.FallbackURL = snapshot.FallbackURL
+	u.Rules = cloneRules(snapshot.Rules)
+	u.Variants = slices.Clone(snapshot.Variants)
+	u.UTM = snapshot.UTM
+	u.ForwardQuery = snapshot.ForwardQuery
+	u.ForwardPath = snapshot.ForwardPath
+	u.RedirectCode = snapshot.RedirectCode
+	u.Robots = snapshot.Robots
+}
+
+// RestoreAccessFrom copies the password and click limit from a snapshot
+func (u *URL) RestoreAccessFrom(snapshot *URL) {
+	u.PasswordHash = snapshot.PasswordHash
+	u.MaxClicks = snapshot.MaxClicks
+}
+
+func cloneRules(rules []RedirectRule) []RedirectRule {
+	clones := slices.Clone(rules)
+	for i := range clones {
+		clones[i].Platforms = slices.Clone(clones[i].Platforms)
+		clones[i].Countries = slices.Clone(clones[i].Countries)
+		clones[i].Languages = slices.Clone(clones[i].Languages)
+		if hours := clones[i].Hours; hours != nil {
+			clone := *hours
+			clones[i].Hours = &clone
+		}
+	}
+	return clones
+}
+
+// HasSchedule reports whether the link has an activation window
+func (u *URL) HasSchedule() bool {
+	return u.ActiveFrom != nil || u.ActiveUntil != nil
+}
+
+// ScheduleState reports where now falls in the link's activation window;
+// links without a window are always live
+func (u *URL) ScheduleState(now time.Time) string {
+	if u.ActiveFrom != nil && now.Before(*u.ActiveFrom) {
+		return SchedulePending
+	}
+	if u.ActiveUntil != nil && !now.Before(*u.ActiveUntil) {
+		return ScheduleEnded
+	}
+	return ScheduleLive
+}
+
+// HasPassword reports whether visitors must enter a passphrase
+func (u *URL) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// Redacted returns a copy of the link that is safe to show to API clients
+func (u *URL) Redacted() *URL {
+	redacted := *u
+	redacted.PasswordProtected = u.HasPassword()
+	redacted.PasswordHash = ""
+	return &redacted
+}
+
+// RedirectStatus returns the status code visitors are redirected with
+func (u *URL) RedirectStatus() int {
+	if u.RedirectCode == 0 {
+		return 302
+	}
+	return u.RedirectCode
+}
+
+// PermanentRedirect reports whether browsers may remember the redirect
+func (u *URL) PermanentRedirect() bool {
+	code := u.RedirectStatus()
+	return code == 301 || code == 308
+}
+
+// IsActive reports whether the link should redirect
+func (u *URL) IsActive() bool {
+	return u.Status == "" || u.Status == URLStatusActive
+}
+
+// ValidURLStatus reports whether status is one of the known URL statuses
+func ValidURLStatus(status string) bool {
+	switch status {
+	case URLStatusActive, URLStatusDisabled, URLStatusBanned:
+		return true
+	}
+	return false
+}
+
+// ValidRedirectCode reports whether code is a redirect status a link may use
+func ValidRedirectCode(code int) bool {
+	switch code {
+	case 301, 302, 307, 308:
+		return true
+	}
+	return false
+}
+
+// robotsDirectives are the X-Robots-Tag directives a link may set
+var robotsDirectives = []string{"all", "none", "noindex", "nofollow", "noarchive", "nosnippet"}
+
+// NormalizeRobotsTag validates a comma-separated list of X-Robots-Tag
+// directives and returns it in canonical form
+func NormalizeRobotsTag(value string) (string, bool) {
+	if strings.TrimSpace(value) == "" {
+		return "", true
+	}
+	var directives []string
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if !slices.Contains(robotsDirectives, directive) {
+			return "", false
+		}
+		if !slices.Contains(directives, directive) {
+			directives = append(directives, directive)
+		}
+	}
+	return strings.Join(directives, ", "), true
+}
+
+// UpdateStatusRequest is the request body for changing a link's status
+type UpdateStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
 }
 
 // CreateURLRequest is the request body for creating a short URL
 type CreateURLRequest struct {
 	URL string `json:"url"`
+	// Domain optionally creates the link on a registered domain
+	Domain string `json:"domain,omitempty"`
+	// Password optionally protects the link with a passphrase
+	Password string `json:"password,omitempty"`
+	// MaxClicks optionally expires the link after that many redirects
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// ActiveFrom and ActiveUntil optionally limit when the link redirects,
+	// sending visitors to FallbackURL or an explanatory page otherwise
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	FallbackURL string     `json:"fallback_url,omitempty"`
+	// Rules optionally route visitors by platform, country, language or
+	// time of day
+	Rules []RedirectRule `json:"rules,omitempty"`
+	// Variants optionally split traffic between weighted destinations
+	Variants []Variant `json:"variants,omitempty"`
+	// UTM, ForwardQuery and ForwardPath optionally add campaign parameters
+	// and pass on the visit's query string and path suffix
+	UTM          *UTM `json:"utm,omitempty"`
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	ForwardPath  bool `json:"forward_path,omitempty"`
+	// RedirectCode optionally picks 301, 307 or 308 instead of 302
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// Robots optionally sets the link's X-Robots-Tag, e.g. "noindex"
+	Robots string `json:"robots,omitempty"`
+}
+
+// UpdateURLRequest is the request body for editing a link; omitted fields
+// keep their current value
+type UpdateURLRequest struct {
+	URL *string `json:"url"`
+	// Password replaces the passphrase; an empty string removes it
+	Password *string `json:"password"`
+	// MaxClicks replaces the click limit; 0 removes it. Redirects already
+	// counted still count against the new limit.
+	MaxClicks *int `json:"max_clicks"`
+	// ActiveFrom and ActiveUntil replace the activation window as RFC 3339
+	// times; an empty string removes that bound
+	ActiveFrom  *string `json:"active_from"`
+	ActiveUntil *string `json:"active_until"`
+	// FallbackURL replaces the fallback; an empty string removes it
+	FallbackURL *string `json:"fallback_url"`
+	// Rules replaces the redirect rules; an empty list removes them
+	Rules *[]RedirectRule `json:"rules"`
+	// Variants replaces the A/B split; an empty list removes it
+	Variants *[]Variant `json:"variants"`
+	// UTM replaces the UTM template; an empty object removes it
+	UTM          *UTM  `json:"utm"`
+	ForwardQuery *bool `json:"forward_query"`
+	ForwardPath  *bool `json:"forward_path"`
+	// RedirectCode replaces the redirect status; 0 restores 302
+	RedirectCode *int `json:"redirect_code"`
+	// Robots replaces the X-Robots-Tag; an empty string restores the default
+	Robots *string `json:"robots"`
+}
+
+// URLVersion is one entry in a link's history: a snapshot of the link as it
+// was at that version
+type URLVersion struct {
+	ShortCode string    `json:"short_code"`
+	Domain    string    `json:"domain,omitempty"`
+	Version   int       `json:"version"`
+	ChangedAt time.Time `json:"changed_at"`
+	Actor     string    `json:"actor"`
+	// RestoredFrom is set when this version was created by a rollback
+	RestoredFrom int  `json:"restored_from,omitempty"`
+	URL          *URL `json:"url"`
 }
 
 // CreateURLResponse is the response body after creating a short URL
 type CreateURLResponse struct {
 	ShortCode   string `json:"short_code"`
+	Domain      string `json:"domain,omitempty"`
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	// Warnings point out settings that may not do what the caller expects
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// URLResponse is a link as returned after an edit, with warnings about its
+// settings
+type URLResponse struct {
+	*URL
+	Warnings []string `json:"warnings,omitempty"`
 }
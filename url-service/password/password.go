@@ -0,0 +1,224 @@
+package password
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"linkshort/pkg/middleware"
+	"linkshort/pkg/ratelimit"
+
+	"url-service/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// MinLength and MaxLength bound passphrases; bcrypt ignores bytes past 72
+	MinLength = 4
+	MaxLength = 72
+
+	cookieName = "linkshort_unlock"
+)
+
+var (
+	// ErrIncorrect is returned for a wrong passphrase
+	ErrIncorrect = errors.New("incorrect passphrase")
+	// ErrInvalid is returned when a new passphrase is too short or too long
+	ErrInvalid = fmt.Errorf("passphrase must be %d to %d bytes", MinLength, MaxLength)
+	// ErrUnavailable is returned when attempts cannot be counted, in which
+	// case no passphrase is checked
+	ErrUnavailable = errors.New("passphrase attempts cannot be counted")
+)
+
+// ThrottledError is returned when a client made too many attempts
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return "too many attempts"
+}
+
+// Hash returns the bcrypt hash stored for a passphrase
+func Hash(passphrase string) (string, error) {
+	if len(passphrase) < MinLength || len(passphrase) > MaxLength {
+		return "", ErrInvalid
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(passphrase), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Options configures a Guard
+type Options struct {
+	// Secret signs unlock cookies. Replicas must share it, or a cookie
+	// issued by one is rejected by the others.
+	Secret []byte
+	// CookieTTL is how long a visitor who entered the passphrase may skip
+	// the prompt
+	CookieTTL time.Duration
+	// Attempts limits guesses per link and client IP
+	Attempts ratelimit.Rule
+	// LinkAttempts limits guesses per link from all clients together, so
+	// guessing from many addresses is throttled too
+	LinkAttempts ratelimit.Rule
+}
+
+// OptionsFromEnv reads LINK_PASSWORD_SECRET, LINK_PASSWORD_COOKIE_TTL,
+// LINK_PASSWORD_MAX_ATTEMPTS, LINK_PASSWORD_MAX_LINK_ATTEMPTS and
+// LINK_PASSWORD_ATTEMPT_WINDOW. Without a secret a random one is generated,
+// which only works with a single replica.
+func OptionsFromEnv() (Options, error) {
+	opts := Options{
+		Secret:    []byte(os.Getenv("LINK_PASSWORD_SECRET")),
+		CookieTTL: 30 * time.Minute,
+	}
+	if len(opts.Secret) == 0 {
+		slog.Warn("LINK_PASSWORD_SECRET is not set, unlock cookies will not survive restarts or work across replicas")
+		opts.Secret = make([]byte, 32)
+		rand.Read(opts.Secret)
+	}
+
+	if value := os.Getenv("LINK_PASSWORD_COOKIE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return opts, fmt.Errorf("invalid LINK_PASSWORD_COOKIE_TTL %q", value)
+		}
+		opts.CookieTTL = ttl
+	}
+
+	attempts := 5
+	if value := os.Getenv("LINK_PASSWORD_MAX_ATTEMPTS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid LINK_PASSWORD_MAX_ATTEMPTS %q", value)
+		}
+		attempts = n
+	}
+	linkAttempts := 50
+	if value := os.Getenv("LINK_PASSWORD_MAX_LINK_ATTEMPTS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid LINK_PASSWORD_MAX_LINK_ATTEMPTS %q", value)
+		}
+		linkAttempts = n
+	}
+	window := 15 * time.Minute
+	if value := os.Getenv("LINK_PASSWORD_ATTEMPT_WINDOW"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("invalid LINK_PASSWORD_ATTEMPT_WINDOW %q", value)
+		}
+		window = d
+	}
+	opts.Attempts = ratelimit.Rule{Rate: float64(attempts) / window.Seconds(), Burst: attempts}
+	opts.LinkAttempts = ratelimit.Rule{Rate: float64(linkAttempts) / window.Seconds(), Burst: linkAttempts}
+
+	return opts, nil
+}
+
+// Guard verifies passphrases of protected links and issues the signed
+// cookies that let visitors skip the prompt
+type Guard struct {
+	limiter ratelimit.Limiter
+	opts    Options
+}
+
+// NewGuard creates a guard counting attempts with limiter
+func NewGuard(limiter ratelimit.Limiter, opts Options) *Guard {
+	return &Guard{limiter: limiter, opts: opts}
+}
+
+// Verify checks passphrase against url's hash. Every attempt counts against
+// the client's budget for the link and then the link's own, so guessing is
+// throttled even when requests are spread over time or over many addresses.
+// When attempts cannot be counted Verify fails closed with ErrUnavailable.
+func (g *Guard) Verify(ctx context.Context, url *models.URL, clientIP, passphrase string) error {
+	budgets := []struct {
+		key  string
+		rule ratelimit.Rule
+	}{
+		{"unlock:" + url.ScopedKey() + ":" + clientIP, g.opts.Attempts},
+		{"unlock:" + url.ScopedKey(), g.opts.LinkAttempts},
+	}
+	for _, budget := range budgets {
+		result, err := g.limiter.Allow(ctx, budget.key, budget.rule)
+		if err != nil {
+			slog.ErrorContext(ctx, "Passphrase throttling unavailable", "link", url.ScopedKey(), "error", err)
+			return ErrUnavailable
+		}
+		if !result.Allowed {
+			return &ThrottledError{RetryAfter: result.RetryAfter}
+		}
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(url.PasswordHash), []byte(passphrase)) != nil {
+		return ErrIncorrect
+	}
+	return nil
+}
+
+// Unlocked reports whether r carries a valid cookie for url
+func (g *Guard) Unlocked(r *http.Request, url *models.URL) bool {
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return false
+	}
+	expiry, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	return err == nil && hmac.Equal(mac, g.sign(url, expiry))
+}
+
+// SetCookie lets the visitor skip the prompt for url until the cookie
+// expires. Browsers keep cookies per host, so together with the link's path
+// this scopes the cookie to the link on its own domain.
+func (g *Guard) SetCookie(w http.ResponseWriter, r *http.Request, url *models.URL) {
+	expires := time.Now().Add(g.opts.CookieTTL)
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    expiry + "." + base64.RawURLEncoding.EncodeToString(g.sign(url, expiry)),
+		Path:     "/" + url.ShortCode,
+		Expires:  expires,
+		MaxAge:   int(g.opts.CookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign binds a cookie to the link, including its domain and workspace, and
+// its current hash, so changing or removing the passphrase invalidates
+// cookies issued for the old one
+func (g *Guard) sign(url *models.URL, expiry string) []byte {
+	mac := hmac.New(sha256.New, g.opts.Secret)
+	mac.Write([]byte(url.ScopedKey() + "\x00" + url.PasswordHash + "\x00" + expiry))
+	return mac.Sum(nil)
+}
+
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return middleware.TrustProxyHeaders && r.Header.Get("X-Forwarded-Proto") == "https"
+}
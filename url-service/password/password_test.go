@@ -0,0 +1,118 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"linkshort/pkg/ratelimit"
+
+	"url-service/models"
+)
+
+func newTestGuard(attempts int) *Guard {
+	return NewGuard(ratelimit.NewMemoryLimiter(), Options{
+		Secret:       []byte("test-secret"),
+		CookieTTL:    time.Minute,
+		Attempts:     ratelimit.Rule{Rate: 0.001, Burst: attempts},
+		LinkAttempts: ratelimit.Rule{Rate: 0.001, Burst: 3 * attempts},
+	})
+}
+
+// brokenLimiter cannot reach its store
+type brokenLimiter struct{}
+
+func (brokenLimiter) Allow(ctx context.Context, key string, rule ratelimit.Rule) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("redis unavailable")
+}
+
+func protectedURL(t *testing.T, ws, domain string) *models.URL {
+	t.Helper()
+	hash, err := Hash("open sesame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.URL{ShortCode: "abc123", Domain: domain, Workspace: ws, PasswordHash: hash}
+}
+
+func TestVerifyThrottlesPerLink(t *testing.T) {
+	g := newTestGuard(1)
+	ctx := context.Background()
+	acme := protectedURL(t, "acme", "go.acme.example")
+	other := protectedURL(t, "other", "go.other.example")
+
+	if err := g.Verify(ctx, acme, "192.0.2.1", "wrong"); !errors.Is(err, ErrIncorrect) {
+		t.Fatalf("first attempt = %v, want ErrIncorrect", err)
+	}
+	var throttled *ThrottledError
+	if err := g.Verify(ctx, acme, "192.0.2.1", "open sesame"); !errors.As(err, &throttled) {
+		t.Fatalf("second attempt = %v, want ThrottledError", err)
+	}
+	if err := g.Verify(ctx, other, "192.0.2.1", "open sesame"); err != nil {
+		t.Fatalf("same short code in another workspace = %v, want nil", err)
+	}
+}
+
+func TestVerifyThrottlesLinkAcrossClients(t *testing.T) {
+	g := newTestGuard(2)
+	ctx := context.Background()
+	url := protectedURL(t, "", "")
+
+	// Each address stays within its own budget, together they use up the
+	// link's
+	for i := range 6 {
+		ip := fmt.Sprintf("192.0.2.%d", i/2)
+		if err := g.Verify(ctx, url, ip, "wrong"); !errors.Is(err, ErrIncorrect) {
+			t.Fatalf("attempt %d from %s = %v, want ErrIncorrect", i+1, ip, err)
+		}
+	}
+	var throttled *ThrottledError
+	if err := g.Verify(ctx, url, "198.51.100.1", "open sesame"); !errors.As(err, &throttled) {
+		t.Fatalf("attempt from a fresh address = %v, want ThrottledError", err)
+	}
+	if throttled.RetryAfter <= 0 {
+		t.Errorf("RetryAfter = %v, want positive", throttled.RetryAfter)
+	}
+}
+
+func TestVerifyFailsClosed(t *testing.T) {
+	g := NewGuard(brokenLimiter{}, Options{Secret: []byte("test-secret")})
+	url := protectedURL(t, "", "")
+
+	if err := g.Verify(context.Background(), url, "192.0.2.1", "open sesame"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Verify without a limiter = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestCookieBoundToLink(t *testing.T) {
+	g := newTestGuard(5)
+	acme := protectedURL(t, "acme", "go.acme.example")
+	// Same short code and passphrase hash, so only the scope tells them apart
+	other := *acme
+	other.Workspace, other.Domain = "other", "go.other.example"
+
+	rec := httptest.NewRecorder()
+	g.SetCookie(rec, httptest.NewRequest("POST", "/abc123", nil), acme)
+	cookie := rec.Result().Cookies()[0]
+	if cookie.Path != "/abc123" {
+		t.Errorf("cookie path = %q, want /abc123", cookie.Path)
+	}
+
+	r := httptest.NewRequest("GET", "/abc123", nil)
+	r.AddCookie(cookie)
+	if !g.Unlocked(r, acme) {
+		t.Error("cookie does not unlock its own link")
+	}
+	if g.Unlocked(r, &other) {
+		t.Error("cookie unlocks the same short code in another workspace")
+	}
+
+	changed := *acme
+	changed.PasswordHash, _ = Hash("new passphrase")
+	if g.Unlocked(r, &changed) {
+		t.Error("cookie survives a passphrase change")
+	}
+}
@@ -0,0 +1,222 @@
+package screening
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// Blocklist screens destinations against local files: one of domains, which
+// also block their subdomains, and one of regular expressions matched against
+// the full URL. Lines starting with # are comments. The files are re-read
+// when they change, and a file that fails to parse keeps the previous list.
+type Blocklist struct {
+	domainsFile  string
+	patternsFile string
+
+	mu       sync.RWMutex
+	domains  map[string]bool
+	patterns []*regexp.Regexp
+	modTimes map[string]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBlocklist loads the given files, either of which may be empty, and
+// checks them for changes every interval
+func NewBlocklist(domainsFile, patternsFile string, interval time.Duration) (*Blocklist, error) {
+	b := &Blocklist{
+		domainsFile:  domainsFile,
+		patternsFile: patternsFile,
+		domains:      make(map[string]bool),
+		modTimes:     make(map[string]time.Time),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		go b.reloadLoop(interval)
+	} else {
+		close(b.done)
+	}
+	return b, nil
+}
+
+// Screen blocks URLs whose host or a parent domain is listed, or that match
+// a listed pattern
+func (b *Blocklist) Screen(ctx context.Context, rawURL string) (Verdict, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Verdict{}, err
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for candidate := host; candidate != ""; {
+		if b.domains[candidate] {
+			return Verdict{Blocked: true, Reason: "domain " + candidate + " is blocklisted", Source: "blocklist"}, nil
+		}
+		_, parent, ok := strings.Cut(candidate, ".")
+		if !ok {
+			break
+		}
+		candidate = parent
+	}
+
+	for _, pattern := range b.patterns {
+		if pattern.MatchString(rawURL) {
+			return Verdict{Blocked: true, Reason: "URL matches a blocklisted pattern", Source: "blocklist"}, nil
+		}
+	}
+	return Verdict{}, nil
+}
+
+// Reload re-reads both files if they changed since the last load
+func (b *Blocklist) Reload() error {
+	domainsMod, domainsChanged, err := b.changed(b.domainsFile)
+	if err != nil {
+		return err
+	}
+	patternsMod, patternsChanged, err := b.changed(b.patternsFile)
+	if err != nil {
+		return err
+	}
+	if !domainsChanged && !patternsChanged {
+		return nil
+	}
+
+	b.mu.RLock()
+	domains, patterns := b.domains, b.patterns
+	b.mu.RUnlock()
+
+	if domainsChanged {
+		if domains, err = loadDomains(b.domainsFile); err != nil {
+			return err
+		}
+	}
+	if patternsChanged {
+		if patterns, err = loadPatterns(b.patternsFile); err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	b.domains, b.patterns = domains, patterns
+	b.mu.Unlock()
+	b.modTimes[b.domainsFile] = domainsMod
+	b.modTimes[b.patternsFile] = patternsMod
+
+	slog.Info("Blocklist loaded", "domains", len(domains), "patterns", len(patterns))
+	return nil
+}
+
+// changed reports whether path was modified since it was last loaded
+func (b *Blocklist) changed(path string) (time.Time, bool, error) {
+	if path == "" {
+		return time.Time{}, false, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return info.ModTime(), !info.ModTime().Equal(b.modTimes[path]), nil
+}
+
+func (b *Blocklist) reloadLoop(interval time.Duration) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			if err := b.Reload(); err != nil {
+				slog.Warn("Blocklist reload failed, keeping previous lists", "error", err)
+			}
+		}
+	}
+}
+
+// Close stops watching the files
+func (b *Blocklist) Close() error {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	<-b.done
+	return nil
+}
+
+func loadDomains(path string) (map[string]bool, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(strings.ToLower(line), "."))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid domain %q", path, line)
+		}
+		domains[domain] = true
+	}
+	return domains, nil
+}
+
+func loadPatterns(path string) ([]*regexp.Regexp, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(lines))
+	for _, line := range lines {
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q: %w", path, line, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// readLines returns the non-empty, non-comment lines of a file
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,127 @@
+package screening
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeList writes lines to path and moves its mtime forward, so Reload
+// sees a change even within the filesystem's timestamp resolution
+func writeList(t *testing.T, path, content string, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(age)
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlocklistScreen(t *testing.T) {
+	dir := t.TempDir()
+	domainsFile := filepath.Join(dir, "domains.txt")
+	patternsFile := filepath.Join(dir, "patterns.txt")
+	writeList(t, domainsFile, "# phishing\nEvil.Example.\n", -time.Hour)
+	writeList(t, patternsFile, `/wp-login\.php$`+"\n", -time.Hour)
+
+	b, err := NewBlocklist(domainsFile, patternsFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"https://evil.example/login", true},
+		{"https://login.EVIL.example./", true},
+		{"https://notevil.example/", false},
+		{"https://example.com/wp-login.php", true},
+		{"https://example.com/wp-login.php.html", false},
+		{"https://example.com/", false},
+	}
+	for _, tt := range tests {
+		verdict, err := b.Screen(context.Background(), tt.url)
+		if err != nil {
+			t.Fatalf("Screen(%q): %v", tt.url, err)
+		}
+		if verdict.Blocked != tt.blocked {
+			t.Errorf("Screen(%q) = %+v, want blocked %v", tt.url, verdict, tt.blocked)
+		}
+	}
+}
+
+func TestBlocklistReload(t *testing.T) {
+	domainsFile := filepath.Join(t.TempDir(), "domains.txt")
+	writeList(t, domainsFile, "old.example\n", -2*time.Hour)
+
+	b, err := NewBlocklist(domainsFile, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	blocked := func(rawURL string) bool {
+		t.Helper()
+		verdict, err := b.Screen(context.Background(), rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return verdict.Blocked
+	}
+
+	writeList(t, domainsFile, "new.example\n", -time.Hour)
+	if err := b.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if blocked("https://old.example/") || !blocked("https://new.example/") {
+		t.Error("Reload did not pick up the changed file")
+	}
+
+	// A file that no longer parses keeps the previous list
+	writeList(t, domainsFile, "not a domain\n", 0)
+	if err := b.Reload(); err == nil {
+		t.Error("Reload of an invalid file succeeded")
+	}
+	if !blocked("https://new.example/") {
+		t.Error("invalid file dropped the previous list")
+	}
+}
+
+func TestBlocklistReloadLoop(t *testing.T) {
+	domainsFile := filepath.Join(t.TempDir(), "domains.txt")
+	writeList(t, domainsFile, "", -time.Hour)
+
+	b, err := NewBlocklist(domainsFile, "", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	writeList(t, domainsFile, "late.example\n", 0)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		verdict, _ := b.Screen(context.Background(), "https://late.example/")
+		if verdict.Blocked {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("blocklist not reloaded in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewBlocklistRejectsInvalidPattern(t *testing.T) {
+	patternsFile := filepath.Join(t.TempDir(), "patterns.txt")
+	writeList(t, patternsFile, "([unclosed\n", 0)
+
+	if _, err := NewBlocklist("", patternsFile, 0); err == nil {
+		t.Error("NewBlocklist accepted an invalid pattern")
+	}
+}
@@ -0,0 +1,114 @@
+package screening
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// maxCachedVerdicts bounds the lookup cache; it is cleared when full
+const maxCachedVerdicts = 10000
+
+// Lookup screens destinations with an external HTTP service in the style of
+// Safe Browsing. The service receives POST {"url": "..."} and answers with
+// {"blocked": true, "reason": "..."}. Verdicts are cached for cacheTTL so
+// redirects do not wait on the service for every click.
+type Lookup struct {
+	endpoint string
+	client   *http.Client
+	cacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedVerdict
+}
+
+type cachedVerdict struct {
+	verdict Verdict
+	expires time.Time
+}
+
+// NewLookup creates a screener for the lookup service at endpoint
+func NewLookup(endpoint string, timeout, cacheTTL time.Duration) *Lookup {
+	return &Lookup{
+		endpoint: endpoint,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		cacheTTL: cacheTTL,
+		cache:    make(map[string]cachedVerdict),
+	}
+}
+
+// Screen asks the lookup service about rawURL
+func (l *Lookup) Screen(ctx context.Context, rawURL string) (Verdict, error) {
+	if verdict, ok := l.cached(rawURL); ok {
+		return verdict, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"url": rawURL})
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("screening service returned %s", resp.Status)
+	}
+
+	var verdict Verdict
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return Verdict{}, fmt.Errorf("invalid screening response: %w", err)
+	}
+	if verdict.Blocked {
+		if verdict.Reason == "" {
+			verdict.Reason = "flagged by the screening service"
+		}
+		verdict.Source = "lookup"
+	}
+
+	l.store(rawURL, verdict)
+	return verdict, nil
+}
+
+func (l *Lookup) cached(rawURL string) (Verdict, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.cache[rawURL]
+	if !ok || time.Now().After(entry.expires) {
+		return Verdict{}, false
+	}
+	return entry.verdict, true
+}
+
+func (l *Lookup) store(rawURL string, verdict Verdict) {
+	if l.cacheTTL <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.cache) >= maxCachedVerdicts {
+		clear(l.cache)
+	}
+	l.cache[rawURL] = cachedVerdict{verdict: verdict, expires: time.Now().Add(l.cacheTTL)}
+}
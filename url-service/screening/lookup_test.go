@@ -0,0 +1,91 @@
+package screening
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lookupServer answers like a lookup service, blocking URLs containing
+// "bad", and counts the requests it gets
+func lookupServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var body struct{ URL string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"blocked": strings.Contains(body.URL, "bad")})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestLookupCachesVerdicts(t *testing.T) {
+	srv, calls := lookupServer(t)
+	l := NewLookup(srv.URL, time.Second, time.Minute)
+	ctx := context.Background()
+
+	for range 3 {
+		verdict, err := l.Screen(ctx, "https://bad.example/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verdict.Blocked || verdict.Source != "lookup" || verdict.Reason == "" {
+			t.Errorf("verdict = %+v, want a lookup block with a reason", verdict)
+		}
+	}
+	if _, err := l.Screen(ctx, "https://good.example/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("service called %d times, want once per URL", got)
+	}
+}
+
+func TestLookupCacheExpires(t *testing.T) {
+	srv, calls := lookupServer(t)
+	l := NewLookup(srv.URL, time.Second, 20*time.Millisecond)
+	ctx := context.Background()
+
+	l.Screen(ctx, "https://good.example/")
+	l.Screen(ctx, "https://good.example/")
+	time.Sleep(30 * time.Millisecond)
+	l.Screen(ctx, "https://good.example/")
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("service called %d times, want again after the TTL", got)
+	}
+}
+
+func TestLookupErrors(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	for name, l := range map[string]*Lookup{
+		"error status": NewLookup(failing.URL, time.Second, time.Minute),
+		"timeout":      NewLookup(slow.URL, 20*time.Millisecond, time.Minute),
+	} {
+		if _, err := l.Screen(context.Background(), "https://example.com/"); err == nil {
+			t.Errorf("%s: Screen succeeded", name)
+		}
+		if len(l.cache) != 0 {
+			t.Errorf("%s: failure was cached", name)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Verdict is the outcome of screening a destination URL
+type Verdict struct {
+	Blocked bool   `json:"blocked"`
+	Reason  string `json:"reason,omitempty"`
+	// Source names the screener that blocked the URL
+	Source string `json:"source,omitempty"`
+}
+
+// DestinationScreener decides whether a destination URL is safe to serve
+type DestinationScreener interface {
+	Screen(ctx context.Context, rawURL string) (Verdict, error)
+}
+
+// Chain runs screeners in order and returns the first block. A screener
+// that fails is logged and skipped so one unavailable source does not stop
+// links from being created or followed.
+type Chain []DestinationScreener
+
+// Screen checks rawURL against every screener in the chain
+func (c Chain) Screen(ctx context.Context, rawURL string) (Verdict, error) {
+	for _, screener := range c {
+		verdict, err := screener.Screen(ctx, rawURL)
+		if err != nil {
+			slog.WarnContext(ctx, "Destination screener failed, skipping", "error", err)
+			continue
+		}
+		if verdict.Blocked {
+			return verdict, nil
+		}
+	}
+	return Verdict{}, nil
+}
+
+// ErrTimeout is returned by ScreenWithin when the verdict takes too long
+var ErrTimeout = errors.New("screening timed out")
+
+// ScreenWithin screens rawURL, waiting at most timeout for the verdict. A
+// screening that takes longer carries on in the background, so a caching
+// screener such as Lookup has the verdict for the next call, and
+// ScreenWithin returns ErrTimeout. A timeout of 0 waits for the verdict.
+func ScreenWithin(ctx context.Context, s DestinationScreener, rawURL string, timeout time.Duration) (Verdict, error) {
+	if timeout <= 0 {
+		return s.Screen(ctx, rawURL)
+	}
+
+	type result struct {
+		verdict Verdict
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// The verdict is worth caching even if the request is gone by then
+		verdict, err := s.Screen(context.WithoutCancel(ctx), rawURL)
+		done <- result{verdict, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.verdict, r.err
+	case <-timer.C:
+		return Verdict{}, ErrTimeout
+	case <-ctx.Done():
+		return Verdict{}, ctx.Err()
+	}
+}
+
+// Close stops screeners that hold background resources
+func (c Chain) Close() error {
+	var errs []error
+	for _, screener := range c {
+		if closer, ok := screener.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Options configures the screeners built by New
+type Options struct {
+	DomainsFile    string
+	PatternsFile   string
+	ReloadInterval time.Duration
+	LookupURL      string
+	LookupTimeout  time.Duration
+	LookupCacheTTL time.Duration
+	// RedirectTimeout bounds how long a redirect waits for a verdict
+	RedirectTimeout time.Duration
+}
+
+// OptionsFromEnv reads BLOCKLIST_DOMAINS_FILE, BLOCKLIST_PATTERNS_FILE,
+// BLOCKLIST_RELOAD_INTERVAL (30s), SCREENING_URL, SCREENING_TIMEOUT (2s),
+// SCREENING_CACHE_TTL (10m) and SCREENING_REDIRECT_TIMEOUT (250ms)
+func OptionsFromEnv() (Options, error) {
+	opts := Options{
+		DomainsFile:     os.Getenv("BLOCKLIST_DOMAINS_FILE"),
+		PatternsFile:    os.Getenv("BLOCKLIST_PATTERNS_FILE"),
+		ReloadInterval:  30 * time.Second,
+		LookupURL:       os.Getenv("SCREENING_URL"),
+		LookupTimeout:   2 * time.Second,
+		LookupCacheTTL:  10 * time.Minute,
+		RedirectTimeout: 250 * time.Millisecond,
+	}
+
+	var err error
+	if opts.ReloadInterval, err = envDuration("BLOCKLIST_RELOAD_INTERVAL", opts.ReloadInterval); err != nil {
+		return opts, err
+	}
+	if opts.LookupTimeout, err = envDuration("SCREENING_TIMEOUT", opts.LookupTimeout); err != nil {
+		return opts, err
+	}
+	if opts.LookupCacheTTL, err = envDuration("SCREENING_CACHE_TTL", opts.LookupCacheTTL); err != nil {
+		return opts, err
+	}
+	if opts.RedirectTimeout, err = envDuration("SCREENING_REDIRECT_TIMEOUT", opts.RedirectTimeout); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return d, nil
+}
+
+// New builds the screeners enabled in opts, local blocklists first so the
+// lookup service is only asked about URLs they let through. It returns nil
+// when nothing is configured.
+func New(opts Options) (Chain, error) {
+	var chain Chain
+
+	if opts.DomainsFile != "" || opts.PatternsFile != "" {
+		blocklist, err := NewBlocklist(opts.DomainsFile, opts.PatternsFile, opts.ReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, blocklist)
+	}
+
+	if opts.LookupURL != "" {
+		chain = append(chain, NewLookup(opts.LookupURL, opts.LookupTimeout, opts.LookupCacheTTL))
+	}
+
+	return chain, nil
+}
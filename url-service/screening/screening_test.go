@@ -0,0 +1,108 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// screenerFunc adapts a function to DestinationScreener
+type screenerFunc func(ctx context.Context, rawURL string) (Verdict, error)
+
+func (f screenerFunc) Screen(ctx context.Context, rawURL string) (Verdict, error) {
+	return f(ctx, rawURL)
+}
+
+func blockContaining(substr, source string) screenerFunc {
+	return func(ctx context.Context, rawURL string) (Verdict, error) {
+		if strings.Contains(rawURL, substr) {
+			return Verdict{Blocked: true, Reason: "contains " + substr, Source: source}, nil
+		}
+		return Verdict{}, nil
+	}
+}
+
+func TestChain(t *testing.T) {
+	failing := screenerFunc(func(ctx context.Context, rawURL string) (Verdict, error) {
+		return Verdict{}, errors.New("service unavailable")
+	})
+	chain := Chain{failing, blockContaining("bad", "first"), blockContaining("bad", "second"), blockContaining("worse", "third")}
+
+	tests := []struct {
+		url    string
+		source string
+	}{
+		{"https://bad.example/", "first"},
+		{"https://worse.example/", "third"},
+		{"https://fine.example/", ""},
+	}
+	for _, tt := range tests {
+		verdict, err := chain.Screen(context.Background(), tt.url)
+		if err != nil {
+			t.Fatalf("Screen(%q): %v", tt.url, err)
+		}
+		if verdict.Source != tt.source || verdict.Blocked != (tt.source != "") {
+			t.Errorf("Screen(%q) = %+v, want blocked by %q", tt.url, verdict, tt.source)
+		}
+	}
+}
+
+func TestChainFailsOpen(t *testing.T) {
+	failing := screenerFunc(func(ctx context.Context, rawURL string) (Verdict, error) {
+		return Verdict{}, errors.New("service unavailable")
+	})
+
+	verdict, err := Chain{failing}.Screen(context.Background(), "https://example.com/")
+	if err != nil || verdict.Blocked {
+		t.Errorf("Screen = %+v, %v; want the URL let through", verdict, err)
+	}
+}
+
+func TestScreenWithin(t *testing.T) {
+	finished := make(chan struct{})
+	slow := screenerFunc(func(ctx context.Context, rawURL string) (Verdict, error) {
+		defer close(finished)
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return Verdict{}, ctx.Err()
+		}
+		return Verdict{Blocked: true}, nil
+	})
+
+	// The request ends before the screener does; it still runs to the end
+	ctx, cancel := context.WithCancel(context.Background())
+	verdict, err := ScreenWithin(ctx, slow, "https://example.com/", 10*time.Millisecond)
+	cancel()
+	if !errors.Is(err, ErrTimeout) || verdict.Blocked {
+		t.Errorf("ScreenWithin = %+v, %v; want ErrTimeout", verdict, err)
+	}
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("screening did not finish in the background")
+	}
+
+	verdict, err = ScreenWithin(context.Background(), blockContaining("bad", "fast"), "https://bad.example/", time.Second)
+	if err != nil || !verdict.Blocked {
+		t.Errorf("ScreenWithin = %+v, %v; want the verdict of a fast screener", verdict, err)
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("SCREENING_REDIRECT_TIMEOUT", "100ms")
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.RedirectTimeout != 100*time.Millisecond || opts.LookupTimeout != 2*time.Second {
+		t.Errorf("opts = %+v", opts)
+	}
+
+	t.Setenv("SCREENING_REDIRECT_TIMEOUT", "soon")
+	if _, err := OptionsFromEnv(); err == nil {
+		t.Error("OptionsFromEnv accepted an invalid duration")
+	}
+}
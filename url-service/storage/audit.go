@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"url-service/models"
+)
+
+// ErrInvalidCursor is returned for an AuditQuery.Before the backend did not
+// issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// AuditStorage is an append-only log of mutations
+type AuditStorage interface {
+	AppendAudit(ctx context.Context, entry *models.AuditEntry) error
+	// FindAudit returns matching entries, newest first
+	FindAudit(ctx context.Context, query models.AuditQuery) ([]*models.AuditEntry, error)
+}
+
+// AppendAudit adds an entry to the in-memory log
+func (s *MemoryStorage) AppendAudit(ctx context.Context, entry *models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *entry
+	s.audit = append(s.audit, &stored)
+	return nil
+}
+
+// FindAudit retrieves matching entries, newest first. Cursors are positions
+// in the log, counted from 1.
+func (s *MemoryStorage) FindAudit(ctx context.Context, query models.AuditQuery) ([]*models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	end := len(s.audit)
+	if query.Before != "" {
+		before, err := strconv.Atoi(query.Before)
+		if err != nil || before < 1 {
+			return nil, ErrInvalidCursor
+		}
+		end = min(end, before-1)
+	}
+
+	entries := make([]*models.AuditEntry, 0)
+	for i := end - 1; i >= 0; i-- {
+		if !query.Matches(s.audit[i]) {
+			continue
+		}
+		found := *s.audit[i]
+		found.Cursor = strconv.Itoa(i + 1)
+		entries = append(entries, &found)
+		if query.Limit > 0 && len(entries) == query.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
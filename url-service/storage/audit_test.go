@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"url-service/models"
+)
+
+func TestFindAuditPagesNewestFirst(t *testing.T) {
+	redisStore, _ := newTestRedis(t)
+	stores := map[string]AuditStorage{
+		"memory": NewMemoryStorage(),
+		"redis":  redisStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i := range 5 {
+				entry := &models.AuditEntry{
+					ID:        fmt.Sprint(i),
+					Timestamp: time.Now(),
+					Action:    models.AuditURLCreate,
+					ShortCode: "abc123",
+				}
+				if err := store.AppendAudit(ctx, entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// The same link key in another workspace never shows up
+			if err := store.AppendAudit(ctx, &models.AuditEntry{ID: "acme", Workspace: "acme", ShortCode: "abc123", Timestamp: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []string
+			query := models.AuditQuery{ShortCode: "abc123", Limit: 2}
+			for page := 0; page < 5; page++ {
+				entries, err := store.FindAudit(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) == 0 {
+					break
+				}
+				for _, entry := range entries {
+					ids = append(ids, entry.ID)
+				}
+				query.Before = entries[len(entries)-1].Cursor
+			}
+			if got := fmt.Sprint(ids); got != "[4 3 2 1 0]" {
+				t.Errorf("pages = %s, want [4 3 2 1 0]", got)
+			}
+
+			if _, err := store.FindAudit(ctx, models.AuditQuery{Before: "not-a-cursor"}); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("invalid cursor = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
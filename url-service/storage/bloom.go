@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"linkshort/pkg/env"
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+)
+
+// BloomOptions configures the short code Bloom filter
+type BloomOptions struct {
+	Capacity        int           // Expected number of short codes
+	FalsePositive   float64       // Target false-positive probability at capacity
+	RebuildInterval time.Duration // How often the filter is reloaded from storage, 0 disables
+	Workspaces      []string      // Workspaces whose links a rebuild loads, the default one if empty
+}
+
+// BloomStats reports how effective the Bloom filter is
+type BloomStats struct {
+	Capacity        int     `json:"capacity"`
+	Items           int     `json:"items"` // insertions since the last rebuild, updates included
+	Resyncing       bool    `json:"resyncing"`
+	Checks          uint64  `json:"checks"`
+	DefiniteMisses  uint64  `json:"definite_misses"`
+	FalsePositives  uint64  `json:"false_positives"`
+	ObservedFPRate  float64 `json:"observed_false_positive_rate"`
+	EstimatedFPRate float64 `json:"estimated_false_positive_rate"`
+}
+
+// bloomFilter is a fixed-size Bloom filter over scoped link keys
+type bloomFilter struct {
+	words  []uint64
+	m      uint64 // number of bits
+	k      uint64 // number of hash functions
+	items  int
+	setBit uint64
+}
+
+func newBloomFilter(capacity int, falsePositive float64) *bloomFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if falsePositive <= 0 || falsePositive >= 1 {
+		falsePositive = 0.01
+	}
+
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(falsePositive) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/float64(capacity)*math.Ln2)))
+
+	return &bloomFilter{
+		words: make([]uint64, (m+63)/64),
+		m:     m,
+		k:     k,
+	}
+}
+
+// locations derives the k bit positions for a key using double hashing
+func (f *bloomFilter) locations(key string) func(i uint64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum, bits.RotateLeft64(sum, 32)|1
+
+	return func(i uint64) uint64 {
+		return (h1 + i*h2) % f.m
+	}
+}
+
+func (f *bloomFilter) add(key string) {
+	loc := f.locations(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := loc(i)
+		mask := uint64(1) << (bit % 64)
+		if f.words[bit/64]&mask == 0 {
+			f.words[bit/64] |= mask
+			f.setBit++
+		}
+	}
+	f.items++
+}
+
+func (f *bloomFilter) mayContain(key string) bool {
+	loc := f.locations(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := loc(i)
+		if f.words[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// estimatedFalsePositive is the probability of a false positive given how
+// many bits are currently set
+func (f *bloomFilter) estimatedFalsePositive() float64 {
+	return math.Pow(float64(f.setBit)/float64(f.m), float64(f.k))
+}
+
+// BloomStorage is a URLStorage decorator that answers lookups for short codes
+// that definitely do not exist without touching the backend, so scanners
+// probing random codes never reach Redis.
+//
+// The filter is built from FindAll on startup and kept current from local
+// saves and, when the backend is a ChangeSubscriber, from saves on other
+// replicas. When the subscription is re-established after a dropped
+// connection the filter is rebuilt, and until that succeeds codes it does
+// not know are looked up in the backend anyway. A periodic rebuild recovers
+// from other missed change notifications.
+type BloomStorage struct {
+	next URLStorage
+	opts BloomOptions
+	stop chan struct{}
+	done func()
+
+	mu        sync.RWMutex
+	filter    *bloomFilter
+	pending   *bloomFilter // receives additions while a rebuild is running
+	resyncing bool         // the filter may lack codes whose notification was missed
+	resyncs   uint64       // resubscriptions so far
+
+	checks         atomic.Uint64
+	definiteMisses atomic.Uint64
+	falsePositives atomic.Uint64
+}
+
+// NewBloomStorage wraps next with a Bloom filter loaded from its contents
+func NewBloomStorage(next URLStorage, opts BloomOptions) (*BloomStorage, error) {
+	s := &BloomStorage{
+		next:   next,
+		opts:   opts,
+		stop:   make(chan struct{}),
+		filter: newBloomFilter(opts.Capacity, opts.FalsePositive),
+	}
+
+	// Subscribe before loading so codes saved during the load are not lost
+	if subscriber, ok := next.(ChangeSubscriber); ok {
+		unsubscribe, err := subscriber.SubscribeChanges(s.add, s.resync)
+		if err != nil {
+			return nil, err
+		}
+		s.done = unsubscribe
+	}
+
+	if err := s.Rebuild(context.Background()); err != nil {
+		if s.done != nil {
+			s.done()
+		}
+		return nil, err
+	}
+
+	if opts.RebuildInterval > 0 {
+		go s.rebuildLoop()
+	}
+
+	return s, nil
+}
+
+// Rebuild reloads the filter from every link of every workspace in the
+// backend
+func (s *BloomStorage) Rebuild(ctx context.Context) error {
+	fresh := newBloomFilter(s.opts.Capacity, s.opts.FalsePositive)
+
+	s.mu.Lock()
+	s.pending = fresh
+	resyncs := s.resyncs
+	s.mu.Unlock()
+
+	urls, err := s.findAll(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = nil
+	if err != nil {
+		return err
+	}
+
+	for _, url := range urls {
+		fresh.add(url.ScopedKey())
+	}
+	s.filter = fresh
+	// A resubscription during the load may have missed codes it did not see
+	if s.resyncs == resyncs {
+		s.resyncing = false
+	}
+	return nil
+}
+
+// resync rebuilds the filter after the change subscription was
+// re-established, sending lookups the filter cannot vouch for to the backend
+// until the rebuild succeeds
+func (s *BloomStorage) resync() {
+	s.mu.Lock()
+	s.resyncing = true
+	s.resyncs++
+	s.mu.Unlock()
+
+	slog.Info("Change subscription re-established, rebuilding Bloom filter")
+	go func() {
+		if err := s.Rebuild(context.Background()); err != nil {
+			slog.Warn("Bloom filter rebuild failed, unknown codes still reach the backend", "error", err)
+		}
+	}()
+}
+
+// findAll loads the links of every workspace the filter covers
+func (s *BloomStorage) findAll(ctx context.Context) ([]*models.URL, error) {
+	workspaces := s.opts.Workspaces
+	if len(workspaces) == 0 {
+		workspaces = []string{workspace.Default}
+	}
+
+	var urls []*models.URL
+	for _, id := range workspaces {
+		found, err := s.next.FindAll(workspace.NewContext(ctx, id))
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, found...)
+	}
+	return urls, nil
+}
+
+func (s *BloomStorage) rebuildLoop() {
+	ticker := time.NewTicker(s.opts.RebuildInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Rebuild(context.Background()); err != nil {
+				slog.Warn("Bloom filter rebuild failed", "error", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// add records a scoped key in the filter and in any rebuild in progress
+func (s *BloomStorage) add(shortCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.filter.add(shortCode)
+	if s.pending != nil {
+		s.pending.add(shortCode)
+	}
+}
+
+// mayContain reports whether the backend has to be asked about a scoped key,
+// and whether the filter knows the key rather than being out of sync
+func (s *BloomStorage) mayContain(shortCode string) (ask, known bool) {
+	s.checks.Add(1)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.filter.mayContain(shortCode) {
+		return true, true
+	}
+	if s.resyncing {
+		return true, false
+	}
+	s.definiteMisses.Add(1)
+	return false, false
+}
+
+// checked records what the backend said about a key mayContain sent to it
+func (s *BloomStorage) checked(shortCode string, known, exists bool) {
+	switch {
+	case known && !exists:
+		s.falsePositives.Add(1)
+	case !known && exists:
+		s.add(shortCode)
+	}
+}
+
+// Save records the short code in the filter before storing the URL, so a
+// concurrent lookup can never be turned away for a code being created
+func (s *BloomStorage) Save(ctx context.Context, url *models.URL) error {
+	s.add(url.ScopedKey())
+	return s.next.Save(ctx, url)
+}
+
+// Replace changes a URL whose code is already in the filter
+func (s *BloomStorage) Replace(ctx context.Context, current, updated *models.URL) error {
+	return s.next.Replace(ctx, current, updated)
+}
+
+// FindByShortCode skips the backend for codes that definitely do not exist
+func (s *BloomStorage) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	key := workspace.Scoped(ctx, shortCode)
+	ask, known := s.mayContain(key)
+	if !ask {
+		return nil, ErrURLNotFound
+	}
+
+	url, err := s.next.FindByShortCode(ctx, shortCode)
+	if err == nil || errors.Is(err, ErrURLNotFound) {
+		s.checked(key, known, err == nil)
+	}
+	return url, err
+}
+
+// FindAll is always served by the backend
+func (s *BloomStorage) FindAll(ctx context.Context) ([]*models.URL, error) {
+	return s.next.FindAll(ctx)
+}
+
+// Exists skips the backend for codes that definitely do not exist
+func (s *BloomStorage) Exists(ctx context.Context, shortCode string) bool {
+	key := workspace.Scoped(ctx, shortCode)
+	ask, known := s.mayContain(key)
+	if !ask {
+		return false
+	}
+
+	exists := s.next.Exists(ctx, shortCode)
+	s.checked(key, known, exists)
+	return exists
+}
+
+// SubscribeChanges forwards to the backend so decorators stacked on top of
+// the filter still see changes from other replicas
+func (s *BloomStorage) SubscribeChanges(onChange func(shortCode string), onResubscribe func()) (func(), error) {
+	if subscriber, ok := s.next.(ChangeSubscriber); ok {
+		return subscriber.SubscribeChanges(onChange, onResubscribe)
+	}
+	return func() {}, nil
+}
+
+// Stats returns filter effectiveness counters
+func (s *BloomStorage) Stats() BloomStats {
+	s.mu.RLock()
+	items := s.filter.items
+	estimated := s.filter.estimatedFalsePositive()
+	resyncing := s.resyncing
+	s.mu.RUnlock()
+
+	stats := BloomStats{
+		Capacity:        s.opts.Capacity,
+		Items:           items,
+		Resyncing:       resyncing,
+		Checks:          s.checks.Load(),
+		DefiniteMisses:  s.definiteMisses.Load(),
+		FalsePositives:  s.falsePositives.Load(),
+		EstimatedFPRate: estimated,
+	}
+	if negatives := stats.DefiniteMisses + stats.FalsePositives; negatives > 0 {
+		stats.ObservedFPRate = float64(stats.FalsePositives) / float64(negatives)
+	}
+	return stats
+}
+
+// Close stops the periodic rebuild and the change subscription
+func (s *BloomStorage) Close() error {
+	close(s.stop)
+	if s.done != nil {
+		s.done()
+	}
+	return nil
+}
+
+// BloomOptionsFromEnv reads filter settings from BLOOM_CAPACITY,
+// BLOOM_FALSE_POSITIVE_RATE and BLOOM_REBUILD_INTERVAL
+func BloomOptionsFromEnv() (BloomOptions, error) {
+	opts := BloomOptions{
+		Capacity:        1000000,
+		FalsePositive:   0.01,
+		RebuildInterval: 15 * time.Minute,
+	}
+
+	var err error
+	if opts.Capacity, err = env.Int("BLOOM_CAPACITY", opts.Capacity); err != nil {
+		return opts, err
+	}
+	if opts.FalsePositive, err = env.Float("BLOOM_FALSE_POSITIVE_RATE", opts.FalsePositive); err != nil {
+		return opts, err
+	}
+	if opts.RebuildInterval, err = env.Duration("BLOOM_REBUILD_INTERVAL", opts.RebuildInterval); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+)
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const capacity, rate = 10000, 0.01
+	f := newBloomFilter(capacity, rate)
+	for i := range capacity {
+		f.add(fmt.Sprintf("code-%d", i))
+	}
+	for i := range capacity {
+		if !f.mayContain(fmt.Sprintf("code-%d", i)) {
+			t.Fatalf("false negative for code-%d", i)
+		}
+	}
+
+	positives := 0
+	for i := range capacity {
+		if f.mayContain(fmt.Sprintf("absent-%d", i)) {
+			positives++
+		}
+	}
+	if observed := float64(positives) / capacity; observed > 2*rate {
+		t.Errorf("false positive rate = %.4f, want about %.2f", observed, rate)
+	}
+}
+
+func TestBloomStorageSkipsUnknownCodes(t *testing.T) {
+	backend := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	ctx := context.Background()
+	acme := workspace.NewContext(ctx, "acme")
+	backend.Save(ctx, &models.URL{ShortCode: "loaded", OriginalURL: "https://example.com"})
+	backend.Save(ctx, &models.URL{ShortCode: "tenant", Workspace: "acme", OriginalURL: "https://example.com"})
+
+	s, err := NewBloomStorage(backend, BloomOptions{
+		Capacity:      1000,
+		FalsePositive: 0.001,
+		Workspaces:    []string{workspace.Default, "acme"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	for _, lookup := range []struct {
+		ctx       context.Context
+		shortCode string
+	}{{ctx, "loaded"}, {acme, "tenant"}} {
+		if _, err := s.FindByShortCode(lookup.ctx, lookup.shortCode); err != nil {
+			t.Errorf("FindByShortCode(%s) of a link present at startup = %v", lookup.shortCode, err)
+		}
+	}
+
+	backend.finds = 0
+	for i := range 100 {
+		if _, err := s.FindByShortCode(ctx, fmt.Sprintf("probe%d", i)); !errors.Is(err, ErrURLNotFound) {
+			t.Fatalf("FindByShortCode(probe%d) = %v", i, err)
+		}
+	}
+	if _, err := s.FindByShortCode(ctx, "tenant"); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("acme link found in the default workspace: %v", err)
+	}
+	if backend.finds > 1 {
+		t.Errorf("%d unknown codes reached the backend", backend.finds)
+	}
+
+	if err := s.Save(ctx, &models.URL{ShortCode: "fresh", OriginalURL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Exists(ctx, "fresh") {
+		t.Error("saved code turned away")
+	}
+
+	stats := s.Stats()
+	if stats.Checks != 104 || stats.DefiniteMisses+stats.FalsePositives != 101 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestBloomStorageLearnsOtherReplicasCodes(t *testing.T) {
+	first, mr := newTestRedis(t)
+	second, err := NewRedisStorage(redisOptions(mr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { second.Close() })
+
+	s, err := NewBloomStorage(first, BloomOptions{Capacity: 1000, FalsePositive: 0.001})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	ctx := context.Background()
+
+	second.Save(ctx, &models.URL{ShortCode: "remote", OriginalURL: "https://example.com"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !s.Exists(ctx, "remote") {
+		if time.Now().After(deadline) {
+			t.Fatal("code saved by another replica never reached the filter")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A rebuild picks up codes whose notification was missed
+	mr.Set(linkKey(workspace.Default, urlKeyPrefix, "missed"), `{"short_code":"missed","original_url":"https://example.com"}`)
+	mr.SAdd(urlListKey, "missed")
+	if s.Exists(ctx, "missed") {
+		t.Fatal("code known before it was announced or rebuilt")
+	}
+	if err := s.Rebuild(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Exists(ctx, "missed") {
+		t.Error("rebuild did not load the missed code")
+	}
+}
+
+func TestBloomStorageResyncsAfterResubscribe(t *testing.T) {
+	first, mr := newTestRedis(t)
+	s, err := NewBloomStorage(first, BloomOptions{Capacity: 1000, FalsePositive: 0.001})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	ctx := context.Background()
+
+	// Saved by another replica while this one's subscription is down, so
+	// the change is never delivered
+	mr.Close()
+	mr.Set(linkKey(workspace.Default, urlKeyPrefix, "missed"), `{"short_code":"missed","original_url":"https://example.com"}`)
+	mr.SAdd(urlListKey, "missed")
+	if s.Exists(ctx, "missed") {
+		t.Fatal("code known before it was announced or rebuilt")
+	}
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.Exists(ctx, "missed") || s.Stats().Resyncing {
+		if time.Now().After(deadline) {
+			t.Fatalf("filter not resynced after resubscribing: %+v", s.Stats())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Back in sync, unknown codes are turned away again
+	before := s.Stats().DefiniteMisses
+	if s.Exists(ctx, "unknown") || s.Stats().DefiniteMisses != before+1 {
+		t.Errorf("unknown code not turned away after the resync: %+v", s.Stats())
+	}
+}
+
+func TestBloomStorageAsksBackendWhileResyncing(t *testing.T) {
+	backend := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	s, err := NewBloomStorage(backend, BloomOptions{Capacity: 1000, FalsePositive: 0.001})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	ctx := context.Background()
+
+	s.mu.Lock()
+	s.resyncing = true
+	s.mu.Unlock()
+	backend.Save(ctx, &models.URL{ShortCode: "missed", OriginalURL: "https://example.com"})
+
+	if _, err := s.FindByShortCode(ctx, "missed"); err != nil {
+		t.Fatalf("FindByShortCode while resyncing = %v", err)
+	}
+	if !s.filter.mayContain(workspace.Scoped(ctx, "missed")) {
+		t.Error("code found in the backend not added to the filter")
+	}
+	if stats := s.Stats(); stats.FalsePositives != 0 || stats.DefiniteMisses != 0 {
+		t.Errorf("lookups while resyncing counted as filter results: %+v", stats)
+	}
+}
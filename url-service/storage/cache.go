@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"linkshort/pkg/env"
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+)
+
+// CacheOptions configures the in-process URL cache
+type CacheOptions struct {
+	Size        int           // Maximum number of cached entries, hits and misses combined
+	TTL         time.Duration // How long a found URL is served from the cache
+	NegativeTTL time.Duration // How long an unknown short code is remembered as missing
+}
+
+// cacheEntry is a cached lookup result; a nil url records a miss. Entries
+// are keyed by scoped key so workspaces never see each other's links.
+type cacheEntry struct {
+	shortCode string
+	url       *models.URL
+	expiresAt time.Time
+}
+
+// pendingLoad tracks the backend lookups of one key in flight
+type pendingLoad struct {
+	lookups    int
+	generation uint64 // bumped on every invalidation of the key
+}
+
+// CachedStorage is a URLStorage decorator that keeps recently resolved short
+// codes in a bounded LRU cache so hot redirects skip the backend entirely.
+// When the backend is a ChangeSubscriber, entries are invalidated as soon as
+// any replica saves the corresponding URL, and the whole cache is dropped
+// when the subscription reconnects, since changes may have been missed.
+type CachedStorage struct {
+	next URLStorage
+	opts CacheOptions
+	stop func()
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+	loads   map[string]*pendingLoad
+}
+
+// NewCachedStorage wraps next with an in-process cache
+func NewCachedStorage(next URLStorage, opts CacheOptions) (*CachedStorage, error) {
+	s := &CachedStorage{
+		next:    next,
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		loads:   make(map[string]*pendingLoad),
+	}
+
+	if subscriber, ok := next.(ChangeSubscriber); ok {
+		stop, err := subscriber.SubscribeChanges(s.invalidate, s.clear)
+		if err != nil {
+			return nil, err
+		}
+		s.stop = stop
+	}
+
+	return s, nil
+}
+
+// Save stores a URL in the backend and drops any cached copy
+func (s *CachedStorage) Save(ctx context.Context, url *models.URL) error {
+	err := s.next.Save(ctx, url)
+	s.invalidate(url.ScopedKey())
+	return err
+}
+
+// Replace swaps a URL in the backend and drops any cached copy, also when
+// the cached one turned out to be stale
+func (s *CachedStorage) Replace(ctx context.Context, current, updated *models.URL) error {
+	err := s.next.Replace(ctx, current, updated)
+	s.invalidate(current.ScopedKey())
+	return err
+}
+
+// FindByShortCode serves a URL from the cache, loading it on a miss
+func (s *CachedStorage) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	key := workspace.Scoped(ctx, shortCode)
+	if url, found := s.get(key); found {
+		if url == nil {
+			return nil, ErrURLNotFound
+		}
+		return url, nil
+	}
+
+	generation := s.startLoad(key)
+	defer s.endLoad(key)
+	url, err := s.next.FindByShortCode(ctx, shortCode)
+	if errors.Is(err, ErrURLNotFound) {
+		s.put(key, nil, generation)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.put(key, url, generation)
+	return copyURL(url), nil
+}
+
+// FindAll is always served by the backend
+func (s *CachedStorage) FindAll(ctx context.Context) ([]*models.URL, error) {
+	return s.next.FindAll(ctx)
+}
+
+// Exists answers from the cache when possible and remembers misses
+func (s *CachedStorage) Exists(ctx context.Context, shortCode string) bool {
+	key := workspace.Scoped(ctx, shortCode)
+	if url, found := s.get(key); found {
+		return url != nil
+	}
+
+	generation := s.startLoad(key)
+	defer s.endLoad(key)
+	exists := s.next.Exists(ctx, shortCode)
+	if !exists {
+		s.put(key, nil, generation)
+	}
+	return exists
+}
+
+// Close stops listening for changes from other replicas
+func (s *CachedStorage) Close() error {
+	if s.stop != nil {
+		s.stop()
+	}
+	return nil
+}
+
+// get returns a copy of the cached URL and whether the code was cached at all
+func (s *CachedStorage) get(shortCode string) (*models.URL, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[shortCode]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.removeElement(elem)
+		return nil, false
+	}
+
+	s.order.MoveToFront(elem)
+	if entry.url == nil {
+		return nil, true
+	}
+	return copyURL(entry.url), true
+}
+
+// put caches the result of a lookup started with startLoad unless the code
+// was invalidated since, in which case the result may already be stale
+func (s *CachedStorage) put(shortCode string, url *models.URL, generation uint64) {
+	ttl := s.opts.TTL
+	if url == nil {
+		ttl = s.opts.NegativeTTL
+	}
+	if ttl <= 0 || s.opts.Size <= 0 {
+		return
+	}
+	if url != nil {
+		url = copyURL(url)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if load := s.loads[shortCode]; load == nil || load.generation != generation {
+		return
+	}
+
+	entry := &cacheEntry{shortCode: shortCode, url: url, expiresAt: time.Now().Add(ttl)}
+	if elem, ok := s.entries[shortCode]; ok {
+		elem.Value = entry
+		s.order.MoveToFront(elem)
+		return
+	}
+
+	s.entries[shortCode] = s.order.PushFront(entry)
+	for s.order.Len() > s.opts.Size {
+		s.removeElement(s.order.Back())
+	}
+}
+
+// invalidate drops a short code from the cache
+func (s *CachedStorage) invalidate(shortCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if load, ok := s.loads[shortCode]; ok {
+		load.generation++
+	}
+	if elem, ok := s.entries[shortCode]; ok {
+		s.removeElement(elem)
+	}
+}
+
+// clear drops every cached entry and the results of lookups in flight
+func (s *CachedStorage) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, load := range s.loads {
+		load.generation++
+	}
+	clear(s.entries)
+	s.order.Init()
+}
+
+// startLoad registers a backend lookup of a short code, returning the
+// generation put checks; every call must be paired with endLoad
+func (s *CachedStorage) startLoad(shortCode string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	load, ok := s.loads[shortCode]
+	if !ok {
+		load = &pendingLoad{}
+		s.loads[shortCode] = load
+	}
+	load.lookups++
+	return load.generation
+}
+
+// endLoad forgets a short code once none of its lookups are in flight, so
+// only codes being looked up are tracked
+func (s *CachedStorage) endLoad(shortCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if load := s.loads[shortCode]; load != nil {
+		if load.lookups--; load.lookups == 0 {
+			delete(s.loads, shortCode)
+		}
+	}
+}
+
+func (s *CachedStorage) removeElement(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.entries, elem.Value.(*cacheEntry).shortCode)
+}
+
+// copyURL keeps callers from mutating cached entries
+func copyURL(url *models.URL) *models.URL {
+	clone := *url
+	return &clone
+}
+
+// CacheOptionsFromEnv reads cache settings from CACHE_SIZE, CACHE_TTL and
+// CACHE_NEGATIVE_TTL. A size of zero disables the cache.
+func CacheOptionsFromEnv() (CacheOptions, error) {
+	opts := CacheOptions{
+		Size:        10000,
+		TTL:         5 * time.Minute,
+		NegativeTTL: 30 * time.Second,
+	}
+
+	var err error
+	if opts.Size, err = env.Int("CACHE_SIZE", opts.Size); err != nil {
+		return opts, err
+	}
+	if opts.TTL, err = env.Duration("CACHE_TTL", opts.TTL); err != nil {
+		return opts, err
+	}
+	if opts.NegativeTTL, err = env.Duration("CACHE_NEGATIVE_TTL", opts.NegativeTTL); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+)
+
+// countingStorage counts the lookups that reach the backend, calling
+// duringFind, when set, while each is in flight
+type countingStorage struct {
+	*MemoryStorage
+	finds      int
+	duringFind func()
+}
+
+func (s *countingStorage) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	s.finds++
+	url, err := s.MemoryStorage.FindByShortCode(ctx, shortCode)
+	if s.duringFind != nil {
+		s.duringFind()
+	}
+	return url, err
+}
+
+func newTestCache(t *testing.T, opts CacheOptions) (*CachedStorage, *countingStorage) {
+	t.Helper()
+	backend := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	cache, err := NewCachedStorage(backend, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache, backend
+}
+
+var testCacheOptions = CacheOptions{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute}
+
+func TestCacheServesHitsAndMisses(t *testing.T) {
+	cache, backend := newTestCache(t, testCacheOptions)
+	ctx := context.Background()
+	cache.Save(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"})
+
+	for range 3 {
+		url, err := cache.FindByShortCode(ctx, "abc123")
+		if err != nil || url.OriginalURL != "https://example.com" {
+			t.Fatalf("FindByShortCode = %v, %v", url, err)
+		}
+		url.OriginalURL = "https://mutated.example"
+	}
+	for range 3 {
+		if _, err := cache.FindByShortCode(ctx, "missing"); !errors.Is(err, ErrURLNotFound) {
+			t.Fatalf("FindByShortCode(missing) = %v", err)
+		}
+	}
+	if backend.finds != 2 {
+		t.Errorf("backend lookups = %d, want 2", backend.finds)
+	}
+
+	url, _ := cache.FindByShortCode(ctx, "abc123")
+	if url.OriginalURL != "https://example.com" {
+		t.Errorf("cached URL was mutated through a returned copy: %s", url.OriginalURL)
+	}
+}
+
+func TestCacheInvalidatesOnWrite(t *testing.T) {
+	cache, _ := newTestCache(t, testCacheOptions)
+	ctx := context.Background()
+
+	if cache.Exists(ctx, "abc123") {
+		t.Fatal("Exists before Save")
+	}
+	cache.Save(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"})
+	current, err := cache.FindByShortCode(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("cached miss survived Save: %v", err)
+	}
+
+	updated := *current
+	updated.OriginalURL = "https://example.org"
+	if err := cache.Replace(ctx, current, &updated); err != nil {
+		t.Fatal(err)
+	}
+	if url, _ := cache.FindByShortCode(ctx, "abc123"); url.OriginalURL != "https://example.org" {
+		t.Errorf("stale entry after Replace: %s", url.OriginalURL)
+	}
+}
+
+func TestCacheIgnoresLookupsRacingAnInvalidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		invalidated string
+		wantCached  bool
+	}{
+		{"same code", "abc123", false},
+		{"other code", "xyz789", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, backend := newTestCache(t, testCacheOptions)
+			ctx := context.Background()
+			backend.Save(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"})
+
+			backend.duringFind = func() { cache.invalidate(workspace.Scoped(ctx, tt.invalidated)) }
+			cache.FindByShortCode(ctx, "abc123")
+			backend.duringFind = nil
+			cache.FindByShortCode(ctx, "abc123")
+
+			if cached := backend.finds == 1; cached != tt.wantCached {
+				t.Errorf("backend lookups = %d, want the first result cached: %v", backend.finds, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, backend := newTestCache(t, CacheOptions{Size: 2, TTL: time.Minute, NegativeTTL: time.Minute})
+	ctx := context.Background()
+
+	cache.FindByShortCode(ctx, "a")
+	cache.FindByShortCode(ctx, "b")
+	cache.FindByShortCode(ctx, "a")
+	cache.FindByShortCode(ctx, "c") // evicts b
+	backend.finds = 0
+
+	cache.FindByShortCode(ctx, "a")
+	cache.FindByShortCode(ctx, "c")
+	if backend.finds != 0 {
+		t.Errorf("recently used entries were evicted")
+	}
+	cache.FindByShortCode(ctx, "b")
+	if backend.finds != 1 {
+		t.Errorf("least recently used entry was kept")
+	}
+}
+
+func TestCacheSeparatesWorkspaces(t *testing.T) {
+	cache, _ := newTestCache(t, testCacheOptions)
+	acme := workspace.NewContext(context.Background(), "acme")
+
+	if _, err := cache.FindByShortCode(acme, "abc123"); !errors.Is(err, ErrURLNotFound) {
+		t.Fatalf("FindByShortCode = %v", err)
+	}
+	cache.Save(context.Background(), &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"})
+	if _, err := cache.FindByShortCode(acme, "abc123"); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("default workspace link visible in acme: %v", err)
+	}
+}
+
+func TestCacheInvalidatedByOtherReplicas(t *testing.T) {
+	first, mr := newTestRedis(t)
+	second, err := NewRedisStorage(redisOptions(mr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { second.Close() })
+
+	cache, err := NewCachedStorage(first, testCacheOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	ctx := context.Background()
+
+	if _, err := cache.FindByShortCode(ctx, "abc123"); !errors.Is(err, ErrURLNotFound) {
+		t.Fatalf("FindByShortCode = %v", err)
+	}
+	// Saved through another replica, so only the change feed tells the cache
+	second.Save(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := cache.FindByShortCode(ctx, "abc123"); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cached miss was never invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCacheClearedAfterResubscribe(t *testing.T) {
+	first, mr := newTestRedis(t)
+	cache, err := NewCachedStorage(first, testCacheOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	ctx := context.Background()
+
+	if _, err := cache.FindByShortCode(ctx, "missed"); !errors.Is(err, ErrURLNotFound) {
+		t.Fatalf("FindByShortCode = %v", err)
+	}
+
+	// Saved by another replica while the subscription is down, so the
+	// change is never delivered
+	mr.Close()
+	mr.Set(linkKey(workspace.Default, urlKeyPrefix, "missed"), `{"short_code":"missed","original_url":"https://example.com"}`)
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := cache.FindByShortCode(ctx, "missed"); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cached miss survived the resubscribe")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
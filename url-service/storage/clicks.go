@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+
+	"linkshort/pkg/workspace"
+)
+
+// ClickCounter counts redirects of links with a click limit
+type ClickCounter interface {
+	// ConsumeClick counts one redirect of a link unless limit redirects were
+	// already counted. It reports whether the redirect is allowed and how
+	// many have been counted, atomically so concurrent redirects can never
+	// exceed the limit. The link is looked up in the context's workspace.
+	ConsumeClick(ctx context.Context, shortCode string, limit int) (allowed bool, used int, err error)
+	// RefundClick gives back a redirect counted by ConsumeClick that was
+	// refused for another reason
+	RefundClick(ctx context.Context, shortCode string) error
+}
+
+// ConsumeClick counts a redirect under the storage mutex
+func (s *MemoryStorage) ConsumeClick(ctx context.Context, shortCode string, limit int) (bool, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := workspace.Scoped(ctx, shortCode)
+	used := s.clickCounts[key]
+	if used >= limit {
+		return false, used, nil
+	}
+	s.clickCounts[key] = used + 1
+	return true, used + 1, nil
+}
+
+// RefundClick uncounts a redirect under the storage mutex
+func (s *MemoryStorage) RefundClick(ctx context.Context, shortCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := workspace.Scoped(ctx, shortCode)
+	if s.clickCounts[key] > 0 {
+		s.clickCounts[key]--
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"linkshort/pkg/workspace"
+)
+
+func TestConsumeClick(t *testing.T) {
+	redisStore, _ := newTestRedis(t)
+	for name, counter := range map[string]ClickCounter{
+		"memory": NewMemoryStorage(),
+		"redis":  redisStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			consume := func(ctx context.Context) (bool, int) {
+				t.Helper()
+				allowed, used, err := counter.ConsumeClick(ctx, "abc123", 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return allowed, used
+			}
+
+			for i, want := range []bool{true, true, false} {
+				if allowed, used := consume(ctx); allowed != want || used != min(i+1, 2) {
+					t.Errorf("click %d = %v, %d used; want %v, %d", i+1, allowed, used, want, min(i+1, 2))
+				}
+			}
+			if allowed, _ := consume(workspace.NewContext(ctx, "acme")); !allowed {
+				t.Error("another workspace's link counted as the same one")
+			}
+
+			// A refunded click can be used again, and refunds stop at zero
+			if err := counter.RefundClick(ctx, "abc123"); err != nil {
+				t.Fatal(err)
+			}
+			if allowed, used := consume(ctx); !allowed || used != 2 {
+				t.Errorf("click after a refund = %v, %d used; want allowed, 2", allowed, used)
+			}
+			for range 3 {
+				if err := counter.RefundClick(ctx, "fresh"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, used, _ := counter.ConsumeClick(ctx, "fresh", 2); used != 1 {
+				t.Errorf("first click after refunds of an unused link = %d used, want 1", used)
+			}
+		})
+	}
+}
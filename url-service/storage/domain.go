@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"url-service/models"
+)
+
+// DomainStorage keeps the registry of branded short domains
+type DomainStorage interface {
+	SaveDomain(ctx context.Context, domain *models.Domain) error
+	FindDomains(ctx context.Context) ([]*models.Domain, error)
+	// DeleteDomain removes a domain, failing with ErrDomainNotFound if it
+	// was not registered
+	DeleteDomain(ctx context.Context, host string) error
+}
+
+// ErrDomainNotFound is returned when a host is not a registered domain
+var ErrDomainNotFound = errors.New("domain not found")
+
+// SaveDomain stores a domain in memory
+func (s *MemoryStorage) SaveDomain(ctx context.Context, domain *models.Domain) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *domain
+	s.domains[domain.Host] = &stored
+	return nil
+}
+
+// FindDomains retrieves every registered domain, ordered by host
+func (s *MemoryStorage) FindDomains(ctx context.Context) ([]*models.Domain, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domains := make([]*models.Domain, 0, len(s.domains))
+	for _, domain := range s.domains {
+		found := *domain
+		domains = append(domains, &found)
+	}
+	sortDomains(domains)
+	return domains, nil
+}
+
+// DeleteDomain removes a domain from memory
+func (s *MemoryStorage) DeleteDomain(ctx context.Context, host string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.domains[host]; !exists {
+		return ErrDomainNotFound
+	}
+	delete(s.domains, host)
+	return nil
+}
+
+func sortDomains(domains []*models.Domain) {
+	slices.SortFunc(domains, func(a, b *models.Domain) int {
+		return strings.Compare(a.Host, b.Host)
+	})
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+)
+
+// HistoryStorage keeps the version history of each link. Versions are
+// appended to the history in the link's workspace and read from the one of
+// the context.
+type HistoryStorage interface {
+	// AppendVersion adds the next version of a link. It fails with
+	// ErrVersionConflict unless version.Version directly follows the last
+	// stored one, so concurrent edits cannot both claim a version.
+	AppendVersion(ctx context.Context, version *models.URLVersion) error
+	// FindHistory returns every version of a link, oldest first
+	FindHistory(ctx context.Context, shortCode string) ([]*models.URLVersion, error)
+	FindVersion(ctx context.Context, shortCode string, version int) (*models.URLVersion, error)
+}
+
+var (
+	// ErrVersionConflict is returned when a version was appended out of order
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrVersionNotFound is returned when a link has no such version
+	ErrVersionNotFound = errors.New("version not found")
+)
+
+// AppendVersion adds a version to the in-memory history
+func (s *MemoryStorage) AppendVersion(ctx context.Context, version *models.URLVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := workspace.KeyPrefix(version.URL.Workspace) + models.LinkKey(version.Domain, version.ShortCode)
+	history := s.history[key]
+	if version.Version != len(history)+1 {
+		return ErrVersionConflict
+	}
+
+	stored := *version
+	snapshot := *version.URL
+	stored.URL = &snapshot
+	s.history[key] = append(history, &stored)
+	return nil
+}
+
+// FindHistory retrieves every version of a link, oldest first
+func (s *MemoryStorage) FindHistory(ctx context.Context, shortCode string) ([]*models.URLVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := s.history[workspace.Scoped(ctx, shortCode)]
+	versions := make([]*models.URLVersion, len(history))
+	for i, version := range history {
+		versions[i] = copyVersion(version)
+	}
+	return versions, nil
+}
+
+// FindVersion retrieves one version of a link
+func (s *MemoryStorage) FindVersion(ctx context.Context, shortCode string, version int) (*models.URLVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := s.history[workspace.Scoped(ctx, shortCode)]
+	if version < 1 || version > len(history) {
+		return nil, ErrVersionNotFound
+	}
+	return copyVersion(history[version-1]), nil
+}
+
+func copyVersion(version *models.URLVersion) *models.URLVersion {
+	found := *version
+	snapshot := *version.URL
+	found.URL = &snapshot
+	return &found
+}
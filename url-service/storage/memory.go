@@ -1,37 +1,88 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 
+	"linkshort/pkg/workspace"
+
 	"url-service/models"
 )
 
 // URLStorage defines the interface for URL storage operations
 // This interface allows easy extension to other storage backends (Redis, PostgreSQL, etc.)
+// Links are looked up by key (see models.LinkKey), which is the bare short
+// code for links on the default domain, within the workspace of the
+// context; Save stores a link in its own workspace.
 type URLStorage interface {
-	Save(url *models.URL) error
-	FindByShortCode(shortCode string) (*models.URL, error)
-	FindAll() ([]*models.URL, error)
-	Exists(shortCode string) bool
+	Save(ctx context.Context, url *models.URL) error
+	// Replace stores updated in place of current unless the stored link
+	// changed since current was read, returning ErrURLConflict then
+	Replace(ctx context.Context, current, updated *models.URL) error
+	FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error)
+	FindAll(ctx context.Context) ([]*models.URL, error)
+	Exists(ctx context.Context, shortCode string) bool
+}
+
+// Pinger is implemented by storage backends that can report whether they are
+// reachable, for readiness probes
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+var (
+	// ErrURLNotFound is returned when no URL exists for a short code
+	ErrURLNotFound = errors.New("url not found")
+	// ErrURLConflict is returned by Replace when the link was changed
+	// concurrently
+	ErrURLConflict = errors.New("url changed concurrently")
+)
+
+// ChangeSubscriber is implemented by storage backends shared between replicas
+// that can notify every replica when a URL is created or modified
+type ChangeSubscriber interface {
+	// SubscribeChanges calls onChange with the scoped key (see URL.ScopedKey)
+	// of every changed URL until the returned stop function is called.
+	// onResubscribe, if not nil, is called whenever the subscription is
+	// re-established after a dropped connection: changes made while it was
+	// down were never delivered.
+	SubscribeChanges(onChange func(shortCode string), onResubscribe func()) (stop func(), err error)
 }
 
 // MemoryStorage implements URLStorage using an in-memory map
 type MemoryStorage struct {
-	mu   sync.RWMutex
-	urls map[string]*models.URL
+	mu      sync.RWMutex
+	urls    map[string]*models.URL
+	reports map[string]*models.Report
+	audit   []*models.AuditEntry
+	history map[string][]*models.URLVersion
+	domains map[string]*models.Domain
+	// clickCounts counts redirects of links with a click limit
+	clickCounts map[string]int
+	// reservedLinks maps the scoped keys of links reserved against a quota
+	// but not yet saved to their workspace
+	reservedLinks map[string]string
+	// monthlyClicks counts redirects per workspace and month
+	monthlyClicks map[string]int
 }
 
 // NewMemoryStorage creates a new in-memory storage instance
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		urls: make(map[string]*models.URL),
+		urls:          make(map[string]*models.URL),
+		reports:       make(map[string]*models.Report),
+		history:       make(map[string][]*models.URLVersion),
+		domains:       make(map[string]*models.Domain),
+		clickCounts:   make(map[string]int),
+		reservedLinks: make(map[string]string),
+		monthlyClicks: make(map[string]int),
 	}
 }
 
 // Save stores a URL in memory
-func (s *MemoryStorage) Save(url *models.URL) error {
+func (s *MemoryStorage) Save(ctx context.Context, url *models.URL) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -39,41 +90,69 @@ func (s *MemoryStorage) Save(url *models.URL) error {
 		url.CreatedAt = time.Now()
 	}
 
-	s.urls[url.ShortCode] = url
+	key := url.ScopedKey()
+	s.urls[key] = url
+	delete(s.reservedLinks, key)
+	return nil
+}
+
+// Replace swaps a URL under the storage mutex
+func (s *MemoryStorage) Replace(ctx context.Context, current, updated *models.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := current.ScopedKey()
+	stored, exists := s.urls[key]
+	if !exists {
+		return ErrURLNotFound
+	}
+	if stored.Revision != current.Revision {
+		return ErrURLConflict
+	}
+	updated.Revision = current.Revision + 1
+	s.urls[key] = updated
 	return nil
 }
 
 // FindByShortCode retrieves a URL by its short code
-func (s *MemoryStorage) FindByShortCode(shortCode string) (*models.URL, error) {
+func (s *MemoryStorage) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	url, exists := s.urls[shortCode]
+	url, exists := s.urls[workspace.Scoped(ctx, shortCode)]
 	if !exists {
-		return nil, errors.New("url not found")
+		return nil, ErrURLNotFound
 	}
 
 	return url, nil
 }
 
-// FindAll retrieves all stored URLs
-func (s *MemoryStorage) FindAll() ([]*models.URL, error) {
+// FindAll retrieves all URLs of the context's workspace
+func (s *MemoryStorage) FindAll(ctx context.Context) ([]*models.URL, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	ws := workspace.FromContext(ctx)
 	urls := make([]*models.URL, 0, len(s.urls))
 	for _, url := range s.urls {
-		urls = append(urls, url)
+		if url.Workspace == ws {
+			urls = append(urls, url)
+		}
 	}
 
 	return urls, nil
 }
 
 // Exists checks if a short code already exists
-func (s *MemoryStorage) Exists(shortCode string) bool {
+func (s *MemoryStorage) Exists(ctx context.Context, shortCode string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	_, exists := s.urls[shortCode]
+	_, exists := s.urls[workspace.Scoped(ctx, shortCode)]
 	return exists
 }
+
+// Ping always succeeds because in-memory storage has no external dependency
+func (s *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"url-service/models"
+)
+
+// backends returns every URLStorage implementation the tests run against
+func backends(t *testing.T) map[string]URLStorage {
+	redisStore, _ := newTestRedis(t)
+	return map[string]URLStorage{
+		"memory": NewMemoryStorage(),
+		"redis":  redisStore,
+	}
+}
+
+func TestReplace(t *testing.T) {
+	for name, store := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := store.Save(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"}); err != nil {
+				t.Fatal(err)
+			}
+			first, _ := store.FindByShortCode(ctx, "abc123")
+			second, _ := store.FindByShortCode(ctx, "abc123")
+
+			banned := *first
+			banned.Status = models.URLStatusBanned
+			if err := store.Replace(ctx, first, &banned); err != nil {
+				t.Fatalf("first Replace: %v", err)
+			}
+
+			edited := *second
+			edited.OriginalURL = "https://example.org"
+			if err := store.Replace(ctx, second, &edited); !errors.Is(err, ErrURLConflict) {
+				t.Fatalf("stale Replace = %v, want ErrURLConflict", err)
+			}
+
+			stored, err := store.FindByShortCode(ctx, "abc123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != models.URLStatusBanned || stored.OriginalURL != "https://example.com" || stored.Revision != 1 {
+				t.Errorf("stored = %+v, want the banned link at revision 1", stored)
+			}
+
+			missing := &models.URL{ShortCode: "missing"}
+			if err := store.Replace(ctx, missing, &models.URL{ShortCode: "missing"}); !errors.Is(err, ErrURLNotFound) {
+				t.Errorf("Replace of a missing link = %v, want ErrURLNotFound", err)
+			}
+		})
+	}
+}
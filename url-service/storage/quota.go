@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"linkshort/pkg/workspace"
+)
+
+// QuotaCounter enforces the quotas of the context's workspace
+type QuotaCounter interface {
+	// ReserveLink claims one of the workspace's limit link slots for the
+	// key of a link about to be created, reporting false when all are
+	// taken. Saving the link fills the slot; ReleaseLink frees it when the
+	// save fails.
+	ReserveLink(ctx context.Context, key string, limit int) (bool, error)
+	ReleaseLink(ctx context.Context, key string) error
+	// ConsumeMonthlyClick counts one redirect against the workspace's
+	// monthly limit unless limit redirects were already counted this
+	// calendar month (UTC)
+	ConsumeMonthlyClick(ctx context.Context, limit int) (bool, error)
+}
+
+// monthlyClicksKey names the counter of the current month's redirects,
+// before it is scoped to a workspace
+func monthlyClicksKey() string {
+	return monthlyClicksKeyPrefix + time.Now().UTC().Format("2006-01")
+}
+
+// ReserveLink counts the workspace's saved and reserved links under the
+// storage mutex
+func (s *MemoryStorage) ReserveLink(ctx context.Context, key string, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws := workspace.FromContext(ctx)
+	scoped := workspace.KeyPrefix(ws) + key
+	if _, exists := s.urls[scoped]; exists {
+		return true, nil
+	}
+	if _, reserved := s.reservedLinks[scoped]; reserved {
+		return true, nil
+	}
+
+	used := 0
+	for _, url := range s.urls {
+		if url.Workspace == ws {
+			used++
+		}
+	}
+	for _, owner := range s.reservedLinks {
+		if owner == ws {
+			used++
+		}
+	}
+	if used >= limit {
+		return false, nil
+	}
+	s.reservedLinks[scoped] = ws
+	return true, nil
+}
+
+// ReleaseLink drops a reservation
+func (s *MemoryStorage) ReleaseLink(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.reservedLinks, workspace.Scoped(ctx, key))
+	return nil
+}
+
+// ConsumeMonthlyClick counts a redirect under the storage mutex
+func (s *MemoryStorage) ConsumeMonthlyClick(ctx context.Context, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := workspace.Scoped(ctx, monthlyClicksKey())
+	if s.monthlyClicks[key] >= limit {
+		return false, nil
+	}
+	s.monthlyClicks[key]++
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+)
+
+// quotaStore is a QuotaCounter along with the links it counts
+type quotaStore interface {
+	URLStorage
+	QuotaCounter
+}
+
+// quotaBackends returns every QuotaCounter implementation
+func quotaBackends(t *testing.T) map[string]quotaStore {
+	redisStore, _ := newTestRedis(t)
+	return map[string]quotaStore{
+		"memory": NewMemoryStorage(),
+		"redis":  redisStore,
+	}
+}
+
+func TestReserveLink(t *testing.T) {
+	for name, store := range quotaBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			acme := workspace.NewContext(context.Background(), "acme")
+			other := workspace.NewContext(context.Background(), "other")
+
+			reserve := func(ctx context.Context, key string) bool {
+				t.Helper()
+				ok, err := store.ReserveLink(ctx, key, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return ok
+			}
+
+			if !reserve(acme, "a") {
+				t.Fatal("first link refused")
+			}
+			if err := store.Save(acme, &models.URL{ShortCode: "a", Workspace: "acme", OriginalURL: "https://example.com"}); err != nil {
+				t.Fatal(err)
+			}
+			if !reserve(acme, "b") {
+				t.Fatal("second link refused")
+			}
+			if reserve(acme, "c") {
+				t.Fatal("link past the limit reserved")
+			}
+			if !reserve(acme, "b") {
+				t.Error("reserving a key again counted it twice")
+			}
+			if !reserve(other, "c") {
+				t.Error("another workspace's links counted against acme")
+			}
+
+			if err := store.ReleaseLink(acme, "b"); err != nil {
+				t.Fatal(err)
+			}
+			if !reserve(acme, "c") {
+				t.Error("released slot not reusable")
+			}
+		})
+	}
+}
+
+func TestConsumeMonthlyClick(t *testing.T) {
+	for name, store := range quotaBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			acme := workspace.NewContext(context.Background(), "acme")
+			for i := range 3 {
+				ok, err := store.ConsumeMonthlyClick(acme, 3)
+				if err != nil || !ok {
+					t.Fatalf("click %d = %v, %v", i, ok, err)
+				}
+			}
+			if ok, _ := store.ConsumeMonthlyClick(acme, 3); ok {
+				t.Error("click past the limit counted")
+			}
+			if ok, _ := store.ConsumeMonthlyClick(context.Background(), 3); !ok {
+				t.Error("another workspace's clicks counted against acme")
+			}
+		})
+	}
+}
+
+func TestRedisMonthlyClicksExpire(t *testing.T) {
+	s, mr := newTestRedis(t)
+	acme := workspace.NewContext(context.Background(), "acme")
+	if _, err := s.ConsumeMonthlyClick(acme, 10); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(workspace.Scoped(acme, monthlyClicksKey())); ttl <= 0 {
+		t.Errorf("monthly counter TTL = %v, want it to expire", ttl)
+	}
+}
@@ -3,48 +3,69 @@ package storage
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"time"
 
+	"linkshort/pkg/workspace"
+
 	"url-service/models"
 
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
 const (
-	urlKeyPrefix = "url:"
-	urlListKey   = "urls:list"
+	urlKeyPrefix     = "url:"
+	urlListKey       = "urls:list"
+	urlChangeChannel = "urls:changed"
 )
 
 // RedisStorage implements URLStorage using Redis
+// It works against a single node, a Sentinel-managed failover group or a
+// Redis Cluster, depending on the options it was created with.
 type RedisStorage struct {
-	client *redis.Client
-	ctx    context.Context
+	client redis.UniversalClient
 }
 
 // NewRedisStorage creates a new Redis storage instance
-func NewRedisStorage(addr string) (*RedisStorage, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: "",
-		DB:       0,
-	})
+func NewRedisStorage(opts *redis.UniversalOptions) (*RedisStorage, error) {
+	client := redis.NewUniversalClient(opts)
+	if err := redisotel.InstrumentTracing(client); err != nil {
+		client.Close()
+		return nil, err
+	}
 
 	ctx := context.Background()
 
 	// Test connection
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, err
 	}
 
 	return &RedisStorage{
 		client: client,
-		ctx:    ctx,
 	}, nil
 }
 
-// Save stores a URL in Redis
-func (s *RedisStorage) Save(url *models.URL) error {
+// linkKey names one of the keys of a link in workspace ws, such as
+// "url:{<key>}". The braces make the link key the hash tag, so on Redis
+// Cluster a link's keys share a slot while different links spread across
+// the cluster. Names are the same in every mode.
+func linkKey(ws, family, key string) string {
+	return workspace.KeyPrefix(ws) + family + "{" + key + "}"
+}
+
+// writeAtomic runs fn as a MULTI/EXEC transaction so related keys are written
+// together or not at all. On Redis Cluster the keys must share a hash slot,
+// so only keys of one link belong in it; workspace indexes are written
+// separately.
+func (s *RedisStorage) writeAtomic(ctx context.Context, fn func(redis.Pipeliner) error) error {
+	_, err := s.client.TxPipelined(ctx, fn)
+	return err
+}
+
+// Save stores a URL in Redis, under its workspace's keys
+func (s *RedisStorage) Save(ctx context.Context, url *models.URL) error {
 	if url.CreatedAt.IsZero() {
 		url.CreatedAt = time.Now()
 	}
@@ -54,28 +75,66 @@ func (s *RedisStorage) Save(url *models.URL) error {
 		return err
 	}
 
-	key := urlKeyPrefix + url.ShortCode
-
-	// Store URL data
-	if err := s.client.Set(s.ctx, key, data, 0).Err(); err != nil {
+	// Add to list for FindAll first: FindAll skips members whose link is
+	// missing, whereas a link missing from the list would never be listed
+	if err := s.client.SAdd(ctx, workspace.KeyPrefix(url.Workspace)+urlListKey, url.Key()).Err(); err != nil {
 		return err
 	}
 
-	// Add to list for FindAll
-	if err := s.client.SAdd(s.ctx, urlListKey, url.ShortCode).Err(); err != nil {
+	return s.writeAtomic(ctx, func(pipe redis.Pipeliner) error {
+		// Store URL data
+		pipe.Set(ctx, linkKey(url.Workspace, urlKeyPrefix, url.Key()), data, 0)
+		// Tell other replicas to drop anything they cached for this code
+		pipe.Publish(ctx, urlChangeChannel, url.ScopedKey())
+		return nil
+	})
+}
+
+// replaceURL overwrites a link if its stored revision is still ARGV[1]. It
+// returns -1 for a missing link and 0 for a changed one.
+var replaceURL = redis.NewScript(`
+local stored = redis.call('GET', KEYS[1])
+if not stored then
+	return -1
+end
+if (cjson.decode(stored).revision or 0) ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2])
+redis.call('PUBLISH', ARGV[3], ARGV[4])
+return 1
+`)
+
+// Replace stores a URL in Redis if nobody changed it since current was read
+func (s *RedisStorage) Replace(ctx context.Context, current, updated *models.URL) error {
+	updated.Revision = current.Revision + 1
+	data, err := json.Marshal(updated)
+	if err != nil {
 		return err
 	}
 
+	key := linkKey(current.Workspace, urlKeyPrefix, current.Key())
+	result, err := replaceURL.Run(ctx, s.client, []string{key},
+		current.Revision, data, urlChangeChannel, current.ScopedKey()).Int()
+	if err != nil {
+		return err
+	}
+	switch result {
+	case -1:
+		return ErrURLNotFound
+	case 0:
+		return ErrURLConflict
+	}
 	return nil
 }
 
 // FindByShortCode retrieves a URL by its short code
-func (s *RedisStorage) FindByShortCode(shortCode string) (*models.URL, error) {
-	key := urlKeyPrefix + shortCode
+func (s *RedisStorage) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	key := linkKey(workspace.FromContext(ctx), urlKeyPrefix, shortCode)
 
-	data, err := s.client.Get(s.ctx, key).Bytes()
+	data, err := s.client.Get(ctx, key).Bytes()
 	if err == redis.Nil {
-		return nil, errors.New("url not found")
+		return nil, ErrURLNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -89,18 +148,37 @@ func (s *RedisStorage) FindByShortCode(shortCode string) (*models.URL, error) {
 	return &url, nil
 }
 
-// FindAll retrieves all stored URLs
-func (s *RedisStorage) FindAll() ([]*models.URL, error) {
-	shortCodes, err := s.client.SMembers(s.ctx, urlListKey).Result()
+// FindAll retrieves all URLs of the context's workspace
+func (s *RedisStorage) FindAll(ctx context.Context) ([]*models.URL, error) {
+	ws := workspace.FromContext(ctx)
+	shortCodes, err := s.client.SMembers(ctx, workspace.KeyPrefix(ws)+urlListKey).Result()
 	if err != nil {
 		return nil, err
 	}
 
+	// Fetch every URL in a single round-trip; the cluster client splits the
+	// pipeline per node, which MGET across hash slots would not allow
+	cmds := make([]*redis.StringCmd, len(shortCodes))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, shortCode := range shortCodes {
+			cmds[i] = pipe.Get(ctx, linkKey(ws, urlKeyPrefix, shortCode))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
 	urls := make([]*models.URL, 0, len(shortCodes))
-	for _, shortCode := range shortCodes {
-		url, err := s.FindByShortCode(shortCode)
-		if err == nil {
-			urls = append(urls, url)
+	for _, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+
+		var url models.URL
+		if err := json.Unmarshal(data, &url); err == nil {
+			urls = append(urls, &url)
 		}
 	}
 
@@ -108,15 +186,53 @@ func (s *RedisStorage) FindAll() ([]*models.URL, error) {
 }
 
 // Exists checks if a short code already exists
-func (s *RedisStorage) Exists(shortCode string) bool {
-	key := urlKeyPrefix + shortCode
-	exists, err := s.client.Exists(s.ctx, key).Result()
+func (s *RedisStorage) Exists(ctx context.Context, shortCode string) bool {
+	key := linkKey(workspace.FromContext(ctx), urlKeyPrefix, shortCode)
+	exists, err := s.client.Exists(ctx, key).Result()
 	if err != nil {
 		return false
 	}
 	return exists > 0
 }
 
+// SubscribeChanges calls onChange for every URL saved by any replica, and
+// onResubscribe when Redis confirms the subscription again after a reconnect
+func (s *RedisStorage) SubscribeChanges(onChange func(shortCode string), onResubscribe func()) (func(), error) {
+	ctx := context.Background()
+	pubsub := s.client.Subscribe(ctx, urlChangeChannel)
+
+	// Wait for the subscription to be confirmed so no change is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	go func() {
+		for msg := range pubsub.ChannelWithSubscriptions() {
+			switch msg := msg.(type) {
+			case *redis.Message:
+				onChange(msg.Payload)
+			case *redis.Subscription:
+				if msg.Kind == "subscribe" && onResubscribe != nil {
+					onResubscribe()
+				}
+			}
+		}
+	}()
+
+	return func() { pubsub.Close() }, nil
+}
+
+// Client exposes the connection so other components can share its pool
+func (s *RedisStorage) Client() redis.UniversalClient {
+	return s.client
+}
+
+// Ping checks that Redis is reachable
+func (s *RedisStorage) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
 // Close closes the Redis connection
 func (s *RedisStorage) Close() error {
 	return s.client.Close()
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	auditStreamKey    = "audit:log"
+	auditURLKeyPrefix = "audit:url:"
+	auditEntryField   = "entry"
+	auditScanBatch    = 500
+)
+
+// AppendAudit adds an entry to the global audit stream and, for entries
+// about a link, to that link's stream so per-link queries stay cheap.
+// Stream IDs carry the Redis time, which is what time range queries use.
+// Each workspace has its own streams. The streams live in different slots on
+// Redis Cluster, so they are appended to one after the other rather than in
+// a transaction.
+func (s *RedisStorage) AppendAudit(ctx context.Context, entry *models.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: workspace.KeyPrefix(entry.Workspace) + auditStreamKey, Values: map[string]any{auditEntryField: data}})
+		if entry.ShortCode != "" {
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: linkKey(entry.Workspace, auditURLKeyPrefix, entry.ShortCode), Values: map[string]any{auditEntryField: data}})
+		}
+		return nil
+	})
+	return err
+}
+
+// FindAudit scans the relevant stream in batches from query.To (or the
+// query.Before cursor, a stream ID) back to query.From, newest first, until
+// query.Limit entries match
+func (s *RedisStorage) FindAudit(ctx context.Context, query models.AuditQuery) ([]*models.AuditEntry, error) {
+	key := workspace.KeyPrefix(query.Workspace) + auditStreamKey
+	if query.ShortCode != "" {
+		key = linkKey(query.Workspace, auditURLKeyPrefix, query.ShortCode)
+	}
+
+	start, end := "-", "+"
+	if !query.From.IsZero() {
+		start = strconv.FormatInt(query.From.UnixMilli(), 10)
+	}
+	if !query.To.IsZero() {
+		end = strconv.FormatInt(query.To.UnixMilli(), 10)
+	}
+	if query.Before != "" {
+		ms, err := streamIDMillis(query.Before)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		if query.To.IsZero() || ms <= query.To.UnixMilli() {
+			end = "(" + query.Before
+		}
+	}
+
+	entries := make([]*models.AuditEntry, 0)
+	for {
+		messages, err := s.client.XRevRangeN(ctx, key, end, start, auditScanBatch).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range messages {
+			data, _ := msg.Values[auditEntryField].(string)
+			var entry models.AuditEntry
+			if err := json.Unmarshal([]byte(data), &entry); err != nil {
+				continue
+			}
+			if !query.Matches(&entry) {
+				continue
+			}
+			entry.Cursor = msg.ID
+			entries = append(entries, &entry)
+			if query.Limit > 0 && len(entries) == query.Limit {
+				return entries, nil
+			}
+		}
+
+		if len(messages) < auditScanBatch {
+			return entries, nil
+		}
+		// Continue before the last ID read
+		end = "(" + messages[len(messages)-1].ID
+	}
+}
+
+// streamIDMillis returns the time part of a stream ID such as "1700000000000-0"
+func streamIDMillis(id string) (int64, error) {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	if _, err := strconv.ParseUint(seq, 10, 64); err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(ms, 10, 64)
+}
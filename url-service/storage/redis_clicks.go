@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+
+	"linkshort/pkg/workspace"
+)
+
+// clickCountKeyPrefix differs from the analytics service's "clicks:" event
+// lists, which live in the same Redis
+const clickCountKeyPrefix = "clickcount:"
+
+// consumeClick increments a link's redirect count unless it reached the
+// limit. The limit is passed on every call rather than stored, so raising
+// it takes effect immediately.
+var consumeClick = redis.NewScript(`
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+if used >= tonumber(ARGV[1]) then
+	return {0, used}
+end
+return {1, redis.call('INCR', KEYS[1])}
+`)
+
+// refundClick decrements a link's redirect count without going below zero
+var refundClick = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') > 0 then
+	redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// ConsumeClick counts a redirect in Redis
+func (s *RedisStorage) ConsumeClick(ctx context.Context, shortCode string, limit int) (bool, int, error) {
+	result, err := consumeClick.Run(ctx, s.client, []string{linkKey(workspace.FromContext(ctx), clickCountKeyPrefix, shortCode)}, limit).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return result[0] == 1, int(result[1]), nil
+}
+
+// RefundClick uncounts a redirect in Redis
+func (s *RedisStorage) RefundClick(ctx context.Context, shortCode string) error {
+	return refundClick.Run(ctx, s.client, []string{linkKey(workspace.FromContext(ctx), clickCountKeyPrefix, shortCode)}).Err()
+}
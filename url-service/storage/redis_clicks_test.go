@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRedisConsumeClickLimit(t *testing.T) {
+	s, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	for i, want := range []bool{true, true, false} {
+		allowed, used, err := s.ConsumeClick(ctx, "abc123", 2)
+		if err != nil {
+			t.Fatalf("click %d: %v", i+1, err)
+		}
+		if allowed != want {
+			t.Errorf("click %d: allowed = %v, want %v", i+1, allowed, want)
+		}
+		if used != min(i+1, 2) {
+			t.Errorf("click %d: used = %d, want %d", i+1, used, min(i+1, 2))
+		}
+	}
+}
+
+// The analytics service keeps each link's click events in a list at
+// "clicks:<key>" in the same Redis, so the counter must not use that key
+func TestRedisConsumeClickBesideAnalyticsEvents(t *testing.T) {
+	s, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	if _, err := mr.Lpush("clicks:abc123", `{"short_code":"abc123"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.ConsumeClick(ctx, "abc123", 10); err != nil {
+		t.Fatalf("ConsumeClick next to the analytics list: %v", err)
+	}
+	if _, err := mr.Lpush("clicks:abc123", `{"short_code":"abc123"}`); err != nil {
+		t.Fatalf("analytics list after ConsumeClick: %v", err)
+	}
+	if got, _ := mr.List("clicks:abc123"); len(got) != 2 {
+		t.Errorf("analytics list has %d events, want 2", len(got))
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"url-service/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const domainsKey = "domains"
+
+// SaveDomain stores a domain in the registry hash, keyed by host
+func (s *RedisStorage) SaveDomain(ctx context.Context, domain *models.Domain) error {
+	data, err := json.Marshal(domain)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, domainsKey, domain.Host, data).Err()
+}
+
+// FindDomains retrieves every registered domain, ordered by host
+func (s *RedisStorage) FindDomains(ctx context.Context) ([]*models.Domain, error) {
+	items, err := s.client.HGetAll(ctx, domainsKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	domains := make([]*models.Domain, 0, len(items))
+	for _, item := range items {
+		var domain models.Domain
+		if err := json.Unmarshal([]byte(item), &domain); err == nil {
+			domains = append(domains, &domain)
+		}
+	}
+	sortDomains(domains)
+	return domains, nil
+}
+
+// DeleteDomain removes a domain from the registry hash
+func (s *RedisStorage) DeleteDomain(ctx context.Context, host string) error {
+	removed, err := s.client.HDel(ctx, domainsKey, host).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrDomainNotFound
+	}
+	return nil
+}
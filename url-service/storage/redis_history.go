@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const historyKeyPrefix = "history:"
+
+// appendVersion pushes a version only if it directly follows the last one
+var appendVersion = redis.NewScript(`
+if redis.call('LLEN', KEYS[1]) ~= tonumber(ARGV[1]) - 1 then
+	return 0
+end
+redis.call('RPUSH', KEYS[1], ARGV[2])
+return 1
+`)
+
+// AppendVersion adds the next version to a link's history list
+func (s *RedisStorage) AppendVersion(ctx context.Context, version *models.URLVersion) error {
+	data, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+
+	key := linkKey(version.URL.Workspace, historyKeyPrefix, models.LinkKey(version.Domain, version.ShortCode))
+	appended, err := appendVersion.Run(ctx, s.client, []string{key}, version.Version, data).Int()
+	if err != nil {
+		return err
+	}
+	if appended == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// FindHistory retrieves every version of a link, oldest first
+func (s *RedisStorage) FindHistory(ctx context.Context, shortCode string) ([]*models.URLVersion, error) {
+	items, err := s.client.LRange(ctx, linkKey(workspace.FromContext(ctx), historyKeyPrefix, shortCode), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*models.URLVersion, 0, len(items))
+	for _, item := range items {
+		var version models.URLVersion
+		if err := json.Unmarshal([]byte(item), &version); err == nil {
+			versions = append(versions, &version)
+		}
+	}
+	return versions, nil
+}
+
+// FindVersion retrieves one version of a link; versions are stored in order
+// so version n is at index n-1
+func (s *RedisStorage) FindVersion(ctx context.Context, shortCode string, version int) (*models.URLVersion, error) {
+	if version < 1 {
+		return nil, ErrVersionNotFound
+	}
+
+	data, err := s.client.LIndex(ctx, linkKey(workspace.FromContext(ctx), historyKeyPrefix, shortCode), int64(version-1)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var found models.URLVersion
+	if err := json.Unmarshal(data, &found); err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
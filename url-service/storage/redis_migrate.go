@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"linkshort/pkg/workspace"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// linkKeysMigratedKey records that MigrateLinkKeys has run
+const linkKeysMigratedKey = "migrations:link-hash-tags"
+
+// linkKeyFamilies are the keys named with linkKey
+var linkKeyFamilies = []string{urlKeyPrefix, historyKeyPrefix, clickCountKeyPrefix, auditURLKeyPrefix}
+
+// MigrateLinkKeys renames the keys of the links of workspaces from the
+// names used before they carried a hash tag ("url:<key>") to linkKey's
+// ("url:{<key>}"). It runs once per Redis; a key that already exists under
+// its new name is left alone. Redis Cluster is skipped: renames across slots
+// are not possible there, and cluster support came with the hash tags.
+// It returns how many keys were renamed.
+func (s *RedisStorage) MigrateLinkKeys(ctx context.Context, workspaces []string) (int, error) {
+	if _, ok := s.client.(*redis.ClusterClient); ok {
+		return 0, nil
+	}
+	done, err := s.client.Exists(ctx, linkKeysMigratedKey).Result()
+	if err != nil || done > 0 {
+		return 0, err
+	}
+
+	renamed := 0
+	for _, ws := range workspaces {
+		prefix := workspace.KeyPrefix(ws)
+		keys, err := s.client.SMembers(ctx, prefix+urlListKey).Result()
+		if err != nil {
+			return renamed, err
+		}
+
+		cmds := make([]*redis.BoolCmd, 0, len(keys)*len(linkKeyFamilies))
+		_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				for _, family := range linkKeyFamilies {
+					cmds = append(cmds, pipe.RenameNX(ctx, prefix+family+key, linkKey(ws, family, key)))
+				}
+			}
+			return nil
+		})
+		// Most links lack some of the keys, which RENAMENX reports as an error
+		if err != nil && !isNoSuchKey(err) {
+			return renamed, err
+		}
+		for _, cmd := range cmds {
+			if err := cmd.Err(); err != nil && !isNoSuchKey(err) {
+				return renamed, err
+			}
+			if cmd.Val() {
+				renamed++
+			}
+		}
+	}
+
+	return renamed, s.client.Set(ctx, linkKeysMigratedKey, 1, 0).Err()
+}
+
+func isNoSuchKey(err error) bool {
+	return strings.Contains(err.Error(), "no such key")
+}
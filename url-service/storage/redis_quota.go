@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+
+	"linkshort/pkg/workspace"
+)
+
+const (
+	monthlyClicksKeyPrefix = "quota:clicks:"
+	// monthlyClicksTTL outlives the longest month, so a counter expires
+	// only once its month is over
+	monthlyClicksTTL = 32 * 24 * 60 * 60
+)
+
+// reserveLink adds a key to a workspace's link set unless the set is full.
+// The set is the one FindAll reads, so links created before the quota was
+// configured count against it too.
+var reserveLink = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 1 then
+	return 1
+end
+if redis.call('SCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('SADD', KEYS[1], ARGV[1])
+return 1
+`)
+
+// consumeMonthlyClick increments a monthly counter unless it reached the
+// limit, starting its expiry with the first redirect of the month
+var consumeMonthlyClick = redis.NewScript(`
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+if used >= tonumber(ARGV[1]) then
+	return 0
+end
+if redis.call('INCR', KEYS[1]) == 1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// ReserveLink claims a slot in the workspace's link set
+func (s *RedisStorage) ReserveLink(ctx context.Context, key string, limit int) (bool, error) {
+	reserved, err := reserveLink.Run(ctx, s.client, []string{workspace.Scoped(ctx, urlListKey)}, key, limit).Int()
+	if err != nil {
+		return false, err
+	}
+	return reserved == 1, nil
+}
+
+// ReleaseLink removes a key whose link was never saved from the link set
+func (s *RedisStorage) ReleaseLink(ctx context.Context, key string) error {
+	return s.client.SRem(ctx, workspace.Scoped(ctx, urlListKey), key).Err()
+}
+
+// ConsumeMonthlyClick counts a redirect in Redis
+func (s *RedisStorage) ConsumeMonthlyClick(ctx context.Context, limit int) (bool, error) {
+	allowed, err := consumeMonthlyClick.Run(ctx, s.client, []string{workspace.Scoped(ctx, monthlyClicksKey())}, limit, monthlyClicksTTL).Int()
+	if err != nil {
+		return false, err
+	}
+	return allowed == 1, nil
+}
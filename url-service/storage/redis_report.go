@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	reportKeyPrefix   = "report:"
+	reportQueuePrefix = "reports:"
+)
+
+var reportStatuses = []string{models.ReportStatusOpen, models.ReportStatusDismissed, models.ReportStatusActioned}
+
+// SaveReport stores a report and files it in the sorted set for its status,
+// scored by creation time so queues read oldest first. The queues are
+// workspace indexes in other slots on Redis Cluster, so they are updated
+// after the report rather than in a transaction; FindReports checks each
+// report's status, so one briefly left in two queues is listed once.
+func (s *RedisStorage) SaveReport(ctx context.Context, report *models.Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	prefix := workspace.KeyPrefix(report.Workspace)
+	if err := s.client.Set(ctx, prefix+reportKeyPrefix+report.ID, data, 0).Err(); err != nil {
+		return err
+	}
+
+	queuePrefix := prefix + reportQueuePrefix
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, queuePrefix+report.Status, redis.Z{
+			Score:  float64(report.CreatedAt.UnixMilli()),
+			Member: report.ID,
+		})
+		for _, status := range reportStatuses {
+			if status != report.Status {
+				pipe.ZRem(ctx, queuePrefix+status, report.ID)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// FindReport retrieves a report of the context's workspace by ID
+func (s *RedisStorage) FindReport(ctx context.Context, id string) (*models.Report, error) {
+	data, err := s.client.Get(ctx, workspace.Scoped(ctx, reportKeyPrefix+id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var report models.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// FindReports retrieves reports with a status, oldest first
+func (s *RedisStorage) FindReports(ctx context.Context, status string, limit int) ([]*models.Report, error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+
+	prefix := workspace.Scoped(ctx, "")
+	ids, err := s.client.ZRange(ctx, prefix+reportQueuePrefix+status, 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]*redis.StringCmd, len(ids))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.Get(ctx, prefix+reportKeyPrefix+id)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	reports := make([]*models.Report, 0, len(ids))
+	for _, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+
+		var report models.Report
+		if err := json.Unmarshal(data, &report); err == nil && report.Status == status {
+			reports = append(reports, &report)
+		}
+	}
+	return reports, nil
+}
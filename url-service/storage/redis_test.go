@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis returns a RedisStorage backed by an in-process Redis
+func newTestRedis(t *testing.T) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	s, err := NewRedisStorage(redisOptions(mr))
+	if err != nil {
+		t.Fatalf("NewRedisStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, mr
+}
+
+// redisOptions connects another client, like another replica, to mr
+func redisOptions(mr *miniredis.Miniredis) *redis.UniversalOptions {
+	return &redis.UniversalOptions{Addrs: []string{mr.Addr()}}
+}
+
+// keySlot is the Redis Cluster slot of key: CRC16 of its hash tag, or of the
+// whole key when it has none
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	crc := uint16(0)
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return int(crc) % 16384
+}
+
+// txRecorder collects the keys written by every MULTI/EXEC transaction
+type txRecorder struct {
+	txs [][]string
+}
+
+func (r *txRecorder) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (r *txRecorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook { return next }
+
+func (r *txRecorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if len(cmds) > 0 && cmds[0].Name() == "multi" {
+			var keys []string
+			for _, cmd := range cmds {
+				switch cmd.Name() {
+				case "multi", "exec", "publish":
+				default:
+					keys = append(keys, fmt.Sprint(cmd.Args()[1]))
+				}
+			}
+			r.txs = append(r.txs, keys)
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestRedisLinkKeysSpreadAcrossSlots(t *testing.T) {
+	if slot := keySlot("foo"); slot != 12182 {
+		t.Fatalf("keySlot(foo) = %d, Redis says 12182", slot)
+	}
+	s, mr := newTestRedis(t)
+	recorder := &txRecorder{}
+	s.client.AddHook(recorder)
+	ctx := workspace.NewContext(context.Background(), "acme")
+
+	for _, code := range []string{"abc123", "xyz789"} {
+		url := &models.URL{ShortCode: code, Workspace: "acme", OriginalURL: "https://example.com"}
+		if err := s.Save(ctx, url); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AppendVersion(ctx, &models.URLVersion{Version: 1, ShortCode: code, URL: url}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.ConsumeClick(ctx, code, 10); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AppendAudit(ctx, &models.AuditEntry{Workspace: "acme", ShortCode: code, Action: "create"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, keys := range recorder.txs {
+		for _, key := range keys[1:] {
+			if keySlot(key) != keySlot(keys[0]) {
+				t.Errorf("transaction spans slots: %v", keys)
+			}
+		}
+	}
+	if len(recorder.txs) == 0 {
+		t.Error("no transaction recorded")
+	}
+
+	slots := make(map[string]map[int]bool)
+	for _, key := range mr.Keys() {
+		for _, code := range []string{"abc123", "xyz789"} {
+			if strings.Contains(key, "{"+code+"}") {
+				if slots[code] == nil {
+					slots[code] = make(map[int]bool)
+				}
+				slots[code][keySlot(key)] = true
+			}
+		}
+	}
+	for code, codeSlots := range slots {
+		if len(codeSlots) != 1 {
+			t.Errorf("keys of %s are in %d slots, want 1", code, len(codeSlots))
+		}
+	}
+	if len(slots) != 2 {
+		t.Fatalf("hash-tagged keys found for %d links, want 2: %v", len(slots), mr.Keys())
+	}
+	for slot := range slots["abc123"] {
+		if slots["xyz789"][slot] {
+			t.Error("keys of different links share a slot")
+		}
+	}
+}
+
+func TestRedisKeysSameInEveryMode(t *testing.T) {
+	s, mr := newTestRedis(t)
+	ctx := context.Background()
+	if err := s.Save(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"url:{abc123}", "urls:list"} {
+		if !mr.Exists(key) {
+			t.Errorf("key %q missing, have %v", key, mr.Keys())
+		}
+	}
+}
+
+func TestMigrateLinkKeys(t *testing.T) {
+	s, mr := newTestRedis(t)
+	mr.Set("url:abc123", `{"short_code":"abc123","original_url":"https://example.com"}`)
+	mr.Set("clickcount:abc123", "4")
+	mr.SAdd("urls:list", "abc123")
+	mr.Set("ws:acme:url:xyz789", `{"short_code":"xyz789","original_url":"https://example.org","workspace":"acme"}`)
+	mr.SAdd("ws:acme:urls:list", "xyz789")
+
+	renamed, err := s.MigrateLinkKeys(context.Background(), []string{workspace.Default, "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed != 3 {
+		t.Errorf("renamed %d keys, want 3", renamed)
+	}
+	for _, key := range []string{"url:abc123", "clickcount:abc123", "ws:acme:url:xyz789"} {
+		if mr.Exists(key) {
+			t.Errorf("legacy key %q still exists", key)
+		}
+	}
+	if _, err := s.FindByShortCode(context.Background(), "abc123"); err != nil {
+		t.Errorf("FindByShortCode after migration: %v", err)
+	}
+	if _, err := s.FindByShortCode(workspace.NewContext(context.Background(), "acme"), "xyz789"); err != nil {
+		t.Errorf("FindByShortCode in acme after migration: %v", err)
+	}
+	if used, _ := mr.Get("clickcount:{abc123}"); used != "4" {
+		t.Errorf("click count = %q after migration, want 4", used)
+	}
+
+	// Later starts leave keys alone
+	mr.Set("url:late", "{}")
+	mr.SAdd("urls:list", "late")
+	if renamed, err := s.MigrateLinkKeys(context.Background(), []string{workspace.Default}); err != nil || renamed != 0 {
+		t.Errorf("second migration renamed %d keys (%v), want none", renamed, err)
+	}
+}
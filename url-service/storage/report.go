@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+)
+
+// ReportStorage keeps abuse reports and the queue of reports awaiting review.
+// Each workspace has its own reports and queues.
+type ReportStorage interface {
+	// SaveReport creates or updates a report, moving it to the queue for
+	// its status in its workspace
+	SaveReport(ctx context.Context, report *models.Report) error
+	// FindReport returns a report of the context's workspace
+	FindReport(ctx context.Context, id string) (*models.Report, error)
+	// FindReports returns up to limit reports of the context's workspace
+	// with the given status, oldest first
+	FindReports(ctx context.Context, status string, limit int) ([]*models.Report, error)
+}
+
+// ErrReportNotFound is returned when no report exists for an ID
+var ErrReportNotFound = errors.New("report not found")
+
+// SaveReport stores a report in memory
+func (s *MemoryStorage) SaveReport(ctx context.Context, report *models.Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *report
+	s.reports[report.ID] = &stored
+	return nil
+}
+
+// FindReport retrieves a report by ID
+func (s *MemoryStorage) FindReport(ctx context.Context, id string) (*models.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	report, exists := s.reports[id]
+	if !exists || report.Workspace != workspace.FromContext(ctx) {
+		return nil, ErrReportNotFound
+	}
+
+	found := *report
+	return &found, nil
+}
+
+// FindReports retrieves reports with a status, oldest first
+func (s *MemoryStorage) FindReports(ctx context.Context, status string, limit int) ([]*models.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ws := workspace.FromContext(ctx)
+	reports := make([]*models.Report, 0)
+	for _, report := range s.reports {
+		if report.Status == status && report.Workspace == ws {
+			found := *report
+			reports = append(reports, &found)
+		}
+	}
+
+	slices.SortFunc(reports, func(a, b *models.Report) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	if limit > 0 && len(reports) > limit {
+		reports = reports[:limit]
+	}
+	return reports, nil
+}
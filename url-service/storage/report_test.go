@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"linkshort/pkg/workspace"
+
+	"url-service/models"
+)
+
+func TestFindReportScopedToWorkspace(t *testing.T) {
+	redisStore, _ := newTestRedis(t)
+	stores := map[string]ReportStorage{
+		"memory": NewMemoryStorage(),
+		"redis":  redisStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			report := &models.Report{
+				ID:        "r1",
+				ShortCode: "abc123",
+				Workspace: "acme",
+				Status:    models.ReportStatusOpen,
+				CreatedAt: time.Now(),
+			}
+			if err := store.SaveReport(context.Background(), report); err != nil {
+				t.Fatal(err)
+			}
+
+			acme := workspace.NewContext(context.Background(), "acme")
+			if _, err := store.FindReport(acme, "r1"); err != nil {
+				t.Fatalf("FindReport in acme: %v", err)
+			}
+			if _, err := store.FindReport(context.Background(), "r1"); !errors.Is(err, ErrReportNotFound) {
+				t.Fatalf("FindReport in default = %v, want ErrReportNotFound", err)
+			}
+
+			reports, err := store.FindReports(acme, models.ReportStatusOpen, 0)
+			if err != nil || len(reports) != 1 {
+				t.Fatalf("FindReports in acme = %v, %v", reports, err)
+			}
+		})
+	}
+}
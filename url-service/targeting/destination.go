@@ -0,0 +1,149 @@
+package targeting
+
+import (
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+
+	"url-service/models"
+)
+
+// maxUTMValueLength bounds a single UTM template value
+const maxUTMValueLength = 200
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z_]*)\}`)
+
+// Placeholders UTM templates may use
+var placeholders = map[string]bool{
+	"short_code": true,
+	"rule":       true,
+	"variant":    true,
+	"platform":   true,
+	"country":    true,
+}
+
+// visitorPlaceholders differ between visitors of the same link and URL
+var visitorPlaceholders = []string{"{platform}", "{country}"}
+
+// Visit describes what a destination is built from besides the link
+type Visit struct {
+	// PathSuffix is what followed the short code in the requested path
+	PathSuffix string
+	// Query is the query string of the visit
+	Query neturl.Values
+	// Values fill in UTM template placeholders, keyed by placeholder name
+	Values map[string]string
+}
+
+// BuildDestination adds the link's UTM parameters and, when the link
+// forwards them, the visit's path suffix and query string to base. Later
+// sources win on conflict: base query < UTM template < visitor query.
+func BuildDestination(base string, link *models.URL, visit Visit) (string, error) {
+	forwardPath := link.ForwardPath && visit.PathSuffix != ""
+	forwardQuery := link.ForwardQuery && len(visit.Query) > 0
+	if !forwardPath && !forwardQuery && link.UTM.IsZero() {
+		return base, nil
+	}
+
+	u, err := neturl.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	if forwardPath {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(visit.PathSuffix, "/")
+		u.RawPath = ""
+	}
+
+	if !link.UTM.IsZero() || forwardQuery {
+		query := u.Query()
+		for key, value := range utmParams(link.UTM) {
+			if value != "" {
+				query.Set(key, expand(value, visit.Values))
+			}
+		}
+		if forwardQuery {
+			for key, values := range visit.Query {
+				query[key] = values
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), nil
+}
+
+// UTMFromURL reads the UTM parameters a destination carries, or nil
+func UTMFromURL(destination string) *models.UTM {
+	u, err := neturl.Parse(destination)
+	if err != nil {
+		return nil
+	}
+	query := u.Query()
+	utm := &models.UTM{
+		Source:   query.Get("utm_source"),
+		Medium:   query.Get("utm_medium"),
+		Campaign: query.Get("utm_campaign"),
+		Term:     query.Get("utm_term"),
+		Content:  query.Get("utm_content"),
+	}
+	if utm.IsZero() {
+		return nil
+	}
+	return utm
+}
+
+// DependsOnVisitor reports whether a UTM template gives visitors of the
+// same URL different destinations
+func DependsOnVisitor(utm *models.UTM) bool {
+	if utm.IsZero() {
+		return false
+	}
+	for _, value := range utmParams(utm) {
+		for _, placeholder := range visitorPlaceholders {
+			if strings.Contains(value, placeholder) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalizeUTM validates a UTM template, returning nil for an empty one
+func NormalizeUTM(utm *models.UTM) (*models.UTM, error) {
+	if utm.IsZero() {
+		return nil, nil
+	}
+	normalized := *utm
+	for key, value := range utmParams(&normalized) {
+		if len(value) > maxUTMValueLength {
+			return nil, fmt.Errorf("%s is longer than %d bytes", key, maxUTMValueLength)
+		}
+		for _, match := range placeholderPattern.FindAllStringSubmatch(value, -1) {
+			if !placeholders[match[1]] {
+				return nil, fmt.Errorf("%s: unknown placeholder %s", key, match[0])
+			}
+		}
+	}
+	return &normalized, nil
+}
+
+func utmParams(utm *models.UTM) map[string]string {
+	if utm == nil {
+		return nil
+	}
+	return map[string]string{
+		"utm_source":   utm.Source,
+		"utm_medium":   utm.Medium,
+		"utm_campaign": utm.Campaign,
+		"utm_term":     utm.Term,
+		"utm_content":  utm.Content,
+	}
+}
+
+func expand(value string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+		return values[strings.Trim(placeholder, "{}")]
+	})
+}
@@ -0,0 +1,52 @@
+package targeting
+
+import (
+	neturl "net/url"
+	"testing"
+
+	"url-service/models"
+)
+
+func TestBuildDestination(t *testing.T) {
+	utm := &models.UTM{Source: "newsletter", Campaign: "{short_code}-{country}"}
+	visit := Visit{
+		PathSuffix: "/docs/page",
+		Query:      neturl.Values{"utm_source": {"twitter"}, "ref": {"a"}},
+		Values:     map[string]string{"short_code": "abc123", "country": "DE"},
+	}
+
+	tests := []struct {
+		name string
+		link models.URL
+		want string
+	}{
+		{"nothing to add", models.URL{}, "https://example.com/base?x=1"},
+		{"UTM template", models.URL{UTM: utm}, "https://example.com/base?utm_campaign=abc123-DE&utm_source=newsletter&x=1"},
+		{"path forwarded", models.URL{ForwardPath: true}, "https://example.com/base/docs/page?x=1"},
+		{"visitor query wins", models.URL{UTM: utm, ForwardQuery: true}, "https://example.com/base?ref=a&utm_campaign=abc123-DE&utm_source=twitter&x=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildDestination("https://example.com/base?x=1", &tt.link, visit)
+			if err != nil || got != tt.want {
+				t.Errorf("BuildDestination() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeUTM(t *testing.T) {
+	if utm, err := NormalizeUTM(&models.UTM{}); utm != nil || err != nil {
+		t.Errorf("empty template = %v, %v, want nil", utm, err)
+	}
+	if _, err := NormalizeUTM(&models.UTM{Campaign: "{short_code}-{variant}"}); err != nil {
+		t.Errorf("known placeholders rejected: %v", err)
+	}
+	if _, err := NormalizeUTM(&models.UTM{Campaign: "{email}"}); err == nil {
+		t.Error("unknown placeholder accepted")
+	}
+
+	if !DependsOnVisitor(&models.UTM{Medium: "{platform}"}) || DependsOnVisitor(&models.UTM{Medium: "{short_code}"}) {
+		t.Error("DependsOnVisitor misjudged a template")
+	}
+}
@@ -0,0 +1,259 @@
+package targeting
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // rules may name any time zone; the runtime image has no zoneinfo
+
+	"url-service/models"
+)
+
+// Platforms a rule can match, detected from the User-Agent
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWindows = "windows"
+	PlatformMacOS   = "macos"
+	PlatformLinux   = "linux"
+	PlatformOther   = "other"
+)
+
+// MaxRules bounds the rules of a single link
+const MaxRules = 20
+
+// CountryHeader names the request header carrying the visitor's ISO 3166
+// country code, as set by a CDN or a GeoIP module in the proxy
+var CountryHeader = "CF-IPCountry"
+
+// Visitor holds the request attributes rules match on
+type Visitor struct {
+	Platform string
+	// Country is an upper-case ISO 3166 alpha-2 code, empty when unknown
+	Country string
+	// Languages are lower-case language tags in order of preference
+	Languages []string
+	Time      time.Time
+}
+
+// VisitorFromRequest describes the visitor who sent r
+func VisitorFromRequest(r *http.Request) Visitor {
+	return Visitor{
+		Platform:  DetectPlatform(r.UserAgent()),
+		Country:   strings.ToUpper(strings.TrimSpace(r.Header.Get(CountryHeader))),
+		Languages: parseAcceptLanguage(r.Header.Get("Accept-Language")),
+		Time:      time.Now(),
+	}
+}
+
+// DetectPlatform maps a User-Agent to one of the Platform constants
+func DetectPlatform(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	// iPadOS reports itself as a Mac; only the touch-capable "Mobile" token
+	// gives it away
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"),
+		strings.Contains(ua, "macintosh") && strings.Contains(ua, "mobile/"):
+		return PlatformIOS
+	case strings.Contains(ua, "android"):
+		return PlatformAndroid
+	case strings.Contains(ua, "windows"):
+		return PlatformWindows
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return PlatformMacOS
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		return PlatformLinux
+	}
+	return PlatformOther
+}
+
+// parseAcceptLanguage returns the tags of an Accept-Language header, most
+// preferred first, skipping those refused with q=0
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+
+	slices.SortStableFunc(tags, func(a, b weighted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+
+	languages := make([]string, len(tags))
+	for i, t := range tags {
+		languages[i] = t.tag
+	}
+	return languages
+}
+
+// Match returns the first rule the visitor satisfies, or nil
+func Match(rules []models.RedirectRule, v Visitor) *models.RedirectRule {
+	for i := range rules {
+		if matches(&rules[i], v) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func matches(rule *models.RedirectRule, v Visitor) bool {
+	if len(rule.Platforms) > 0 && !slices.Contains(rule.Platforms, v.Platform) {
+		return false
+	}
+	if len(rule.Countries) > 0 && !slices.Contains(rule.Countries, v.Country) {
+		return false
+	}
+	if len(rule.Languages) > 0 && !matchesLanguage(rule.Languages, v.Languages) {
+		return false
+	}
+	if rule.Hours != nil && !inHours(rule.Hours, v.Time) {
+		return false
+	}
+	return true
+}
+
+// matchesLanguage compares the visitor's first language with the rule's.
+// A rule for "pt" matches "pt-BR"; a rule for "pt-br" matches only that
+// region.
+func matchesLanguage(ruleLanguages, visitorLanguages []string) bool {
+	if len(visitorLanguages) == 0 {
+		return false
+	}
+	preferred := visitorLanguages[0]
+	base, _, _ := strings.Cut(preferred, "-")
+	return slices.Contains(ruleLanguages, preferred) || slices.Contains(ruleLanguages, base)
+}
+
+func inHours(hours *models.TimeOfDay, now time.Time) bool {
+	loc, err := location(hours.TimeZone)
+	if err != nil {
+		return false
+	}
+	start, _ := time.Parse("15:04", hours.Start)
+	end, _ := time.Parse("15:04", hours.End)
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	until := end.Hour()*60 + end.Minute()
+	if from <= until {
+		return minute >= from && minute < until
+	}
+	return minute >= from || minute < until
+}
+
+// locations caches loaded time zones; LoadLocation reads the zone database
+// on every call
+var locations sync.Map
+
+func location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// Normalize validates rules and puts their conditions in the form Match
+// expects. Rules without an ID are numbered by position.
+func Normalize(rules []models.RedirectRule) error {
+	if len(rules) > MaxRules {
+		return fmt.Errorf("a link can have at most %d rules", MaxRules)
+	}
+
+	ids := make(map[string]bool, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		if rule.ID = strings.TrimSpace(rule.ID); rule.ID == "" {
+			rule.ID = fmt.Sprintf("rule-%d", i+1)
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("duplicate rule id %q", rule.ID)
+		}
+		ids[rule.ID] = true
+
+		if rule.Destination == "" {
+			return fmt.Errorf("rule %q has no destination", rule.ID)
+		}
+		if len(rule.Platforms) == 0 && len(rule.Countries) == 0 && len(rule.Languages) == 0 && rule.Hours == nil {
+			return fmt.Errorf("rule %q has no conditions", rule.ID)
+		}
+
+		for j, platform := range rule.Platforms {
+			platform = strings.ToLower(strings.TrimSpace(platform))
+			switch platform {
+			case PlatformIOS, PlatformAndroid, PlatformWindows, PlatformMacOS, PlatformLinux, PlatformOther:
+			default:
+				return fmt.Errorf("rule %q: unknown platform %q", rule.ID, platform)
+			}
+			rule.Platforms[j] = platform
+		}
+		for j, country := range rule.Countries {
+			country = strings.ToUpper(strings.TrimSpace(country))
+			if len(country) != 2 {
+				return fmt.Errorf("rule %q: country %q is not an ISO 3166 alpha-2 code", rule.ID, country)
+			}
+			rule.Countries[j] = country
+		}
+		for j, language := range rule.Languages {
+			language = strings.ToLower(strings.TrimSpace(language))
+			if language == "" {
+				return fmt.Errorf("rule %q: empty language", rule.ID)
+			}
+			rule.Languages[j] = language
+		}
+
+		if rule.Hours != nil {
+			if _, err := time.Parse("15:04", rule.Hours.Start); err != nil {
+				return fmt.Errorf("rule %q: hours start must be HH:MM", rule.ID)
+			}
+			if _, err := time.Parse("15:04", rule.Hours.End); err != nil {
+				return fmt.Errorf("rule %q: hours end must be HH:MM", rule.ID)
+			}
+			if rule.Hours.Start == rule.Hours.End {
+				return fmt.Errorf("rule %q: hours start and end must differ", rule.ID)
+			}
+			if _, err := location(rule.Hours.TimeZone); err != nil {
+				return fmt.Errorf("rule %q: unknown time zone %q", rule.ID, rule.Hours.TimeZone)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package targeting
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"url-service/models"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148":       PlatformIOS,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 Version/17.0 Mobile/15E148": PlatformIOS,
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36":   PlatformAndroid,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36":         PlatformWindows,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 Chrome/120.0 Safari/537.36":   PlatformMacOS,
+		"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0":                  PlatformLinux,
+		"curl/8.4.0": PlatformOther,
+		"":           PlatformOther,
+	}
+	for ua, want := range tests {
+		if got := DetectPlatform(ua); got != want {
+			t.Errorf("DetectPlatform(%q) = %s, want %s", ua, got, want)
+		}
+	}
+}
+
+func TestVisitorFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/abc123", nil)
+	r.Header.Set(CountryHeader, " de ")
+	r.Header.Set("Accept-Language", "en;q=0.5, de-DE, fr;q=0, *;q=0.1, pt-BR;q=0.8")
+
+	v := VisitorFromRequest(r)
+	if v.Country != "DE" {
+		t.Errorf("Country = %q, want DE", v.Country)
+	}
+	if want := []string{"de-de", "pt-br", "en"}; !slices.Equal(v.Languages, want) {
+		t.Errorf("Languages = %q, want %q", v.Languages, want)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules := []models.RedirectRule{
+		{ID: "ios-de", Platforms: []string{PlatformIOS}, Countries: []string{"DE"}, Destination: "https://a.example"},
+		{ID: "portuguese", Languages: []string{"pt"}, Destination: "https://b.example"},
+		{ID: "brazil", Languages: []string{"pt-br"}, Destination: "https://c.example"},
+		{ID: "night", Hours: &models.TimeOfDay{Start: "22:00", End: "06:00", TimeZone: "Europe/Berlin"}, Destination: "https://d.example"},
+	}
+	noon := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC) // 12:00 in Berlin
+	night := time.Date(2024, 6, 1, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		visitor Visitor
+		want    string
+	}{
+		{"all conditions of a rule", Visitor{Platform: PlatformIOS, Country: "DE", Time: noon}, "ios-de"},
+		{"one condition missing", Visitor{Platform: PlatformAndroid, Country: "DE", Time: noon}, ""},
+		{"base language matches regions", Visitor{Languages: []string{"pt-pt"}, Time: noon}, "portuguese"},
+		{"first matching rule wins", Visitor{Languages: []string{"pt-br"}, Time: noon}, "portuguese"},
+		{"only the preferred language counts", Visitor{Languages: []string{"en", "pt"}, Time: noon}, ""},
+		{"window wrapping midnight", Visitor{Time: night}, "night"},
+		{"outside the window", Visitor{Time: noon}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if rule := Match(rules, tt.visitor); rule != nil {
+				got = rule.ID
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	rules := []models.RedirectRule{
+		{Platforms: []string{" iOS "}, Countries: []string{"de"}, Languages: []string{"PT-BR"}, Destination: "https://a.example"},
+	}
+	if err := Normalize(rules); err != nil {
+		t.Fatal(err)
+	}
+	if rule := rules[0]; rule.ID != "rule-1" || rule.Platforms[0] != "ios" || rule.Countries[0] != "DE" || rule.Languages[0] != "pt-br" {
+		t.Errorf("normalized rule = %+v", rule)
+	}
+
+	invalid := map[string]models.RedirectRule{
+		"no destination":   {Countries: []string{"DE"}},
+		"no conditions":    {Destination: "https://a.example"},
+		"unknown platform": {Platforms: []string{"beos"}, Destination: "https://a.example"},
+		"bad country":      {Countries: []string{"GER"}, Destination: "https://a.example"},
+		"bad hours":        {Hours: &models.TimeOfDay{Start: "25:00", End: "06:00"}, Destination: "https://a.example"},
+		"empty window":     {Hours: &models.TimeOfDay{Start: "06:00", End: "06:00"}, Destination: "https://a.example"},
+		"unknown zone":     {Hours: &models.TimeOfDay{Start: "06:00", End: "08:00", TimeZone: "Mars/Olympus"}, Destination: "https://a.example"},
+	}
+	for name, rule := range invalid {
+		if err := Normalize([]models.RedirectRule{rule}); err == nil {
+			t.Errorf("%s: Normalize accepted %+v", name, rule)
+		}
+	}
+
+	duplicate := []models.RedirectRule{
+		{ID: "x", Countries: []string{"DE"}, Destination: "https://a.example"},
+		{ID: "x", Countries: []string{"FR"}, Destination: "https://b.example"},
+	}
+	if err := Normalize(duplicate); err == nil {
+		t.Error("Normalize accepted duplicate ids")
+	}
+	if err := Normalize(make([]models.RedirectRule, MaxRules+1)); err == nil {
+		t.Error("Normalize accepted too many rules")
+	}
+}
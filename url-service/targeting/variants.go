@@ -0,0 +1,85 @@
+package targeting
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"url-service/models"
+)
+
+const (
+	// MaxVariants bounds the destinations of a single split
+	MaxVariants = 10
+	// MaxWeight bounds a single variant's weight, so weights can be given
+	// as percentages or basis points
+	MaxWeight = 10000
+)
+
+// FindVariant returns the variant with the given ID, or nil
+func FindVariant(variants []models.Variant, id string) *models.Variant {
+	for i := range variants {
+		if variants[i].ID == id {
+			return &variants[i]
+		}
+	}
+	return nil
+}
+
+// AssignVariant picks a variant for a visitor by hashing linkKey and
+// visitorKey, so the same visitor lands on the same variant of a link for as
+// long as the weights stay unchanged
+func AssignVariant(variants []models.Variant, linkKey, visitorKey string) *models.Variant {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(linkKey + "\x00" + visitorKey))
+	point := int(h.Sum64() % uint64(total))
+	for i := range variants {
+		if point < variants[i].Weight {
+			return &variants[i]
+		}
+		point -= variants[i].Weight
+	}
+	return nil
+}
+
+// NormalizeVariants validates an A/B split. Variants without an ID are
+// named "a", "b", ... by position.
+func NormalizeVariants(variants []models.Variant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	if len(variants) < 2 {
+		return fmt.Errorf("a split needs at least 2 variants")
+	}
+	if len(variants) > MaxVariants {
+		return fmt.Errorf("a split can have at most %d variants", MaxVariants)
+	}
+
+	ids := make(map[string]bool, len(variants))
+	for i := range variants {
+		v := &variants[i]
+		if v.ID = strings.TrimSpace(v.ID); v.ID == "" {
+			v.ID = string(rune('a' + i))
+		}
+		if ids[v.ID] {
+			return fmt.Errorf("duplicate variant id %q", v.ID)
+		}
+		ids[v.ID] = true
+
+		if v.Destination == "" {
+			return fmt.Errorf("variant %q has no destination", v.ID)
+		}
+		if v.Weight < 1 || v.Weight > MaxWeight {
+			return fmt.Errorf("variant %q: weight must be between 1 and %d", v.ID, MaxWeight)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package targeting
+
+import (
+	"fmt"
+	"testing"
+
+	"url-service/models"
+)
+
+func TestAssignVariant(t *testing.T) {
+	variants := []models.Variant{
+		{ID: "a", Weight: 50, Destination: "https://a.example"},
+		{ID: "b", Weight: 50, Destination: "https://b.example"},
+	}
+
+	counts := map[string]int{}
+	differs := false
+	for i := range 1000 {
+		visitor := fmt.Sprintf("192.0.2.%d\x00agent", i)
+		first := AssignVariant(variants, "abc123", visitor)
+		if again := AssignVariant(variants, "abc123", visitor); again.ID != first.ID {
+			t.Fatalf("visitor %q moved from %s to %s", visitor, first.ID, again.ID)
+		}
+		counts[first.ID]++
+		if AssignVariant(variants, "ws:acme:go.acme.example/abc123", visitor).ID != first.ID {
+			differs = true
+		}
+	}
+	if counts["a"] < 400 || counts["b"] < 400 {
+		t.Errorf("50/50 split assigned %v", counts)
+	}
+	if !differs {
+		t.Error("links sharing a short code split visitors identically")
+	}
+
+	if v := AssignVariant(nil, "abc123", "visitor"); v != nil {
+		t.Errorf("no variants assigned %v", v)
+	}
+}
+
+func TestNormalizeVariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []models.Variant
+		wantErr  bool
+	}{
+		{"none", nil, false},
+		{"single", []models.Variant{{Weight: 1, Destination: "https://a.example"}}, true},
+		{"unnamed", []models.Variant{{Weight: 1, Destination: "https://a.example"}, {Weight: 1, Destination: "https://b.example"}}, false},
+		{"duplicate id", []models.Variant{{ID: "x", Weight: 1, Destination: "https://a.example"}, {ID: "x", Weight: 1, Destination: "https://b.example"}}, true},
+		{"no destination", []models.Variant{{Weight: 1, Destination: "https://a.example"}, {Weight: 1}}, true},
+		{"zero weight", []models.Variant{{Weight: 0, Destination: "https://a.example"}, {Weight: 1, Destination: "https://b.example"}}, true},
+		{"weight too large", []models.Variant{{Weight: MaxWeight + 1, Destination: "https://a.example"}, {Weight: 1, Destination: "https://b.example"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NormalizeVariants(tt.variants)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeVariants() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.name == "unnamed" && (tt.variants[0].ID != "a" || tt.variants[1].ID != "b") {
+				t.Errorf("ids = %q, %q, want a, b", tt.variants[0].ID, tt.variants[1].ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"url-service/models"
+	"url-service/storage"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedStorage is a URLStorage decorator that wraps every call in a span
+type TracedStorage struct {
+	next storage.URLStorage
+}
+
+// TraceStorage wraps a storage with tracing spans
+func TraceStorage(next storage.URLStorage) *TracedStorage {
+	return &TracedStorage{next: next}
+}
+
+func startSpan(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, storage.ErrURLNotFound) && !errors.Is(err, storage.ErrURLConflict) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Save stores a URL
+func (s *TracedStorage) Save(ctx context.Context, url *models.URL) error {
+	ctx, span := startSpan(ctx, "Save", attribute.String("short_code", url.ShortCode))
+	err := s.next.Save(ctx, url)
+	endSpan(span, err)
+	return err
+}
+
+// Replace swaps a stored URL
+func (s *TracedStorage) Replace(ctx context.Context, current, updated *models.URL) error {
+	ctx, span := startSpan(ctx, "Replace", attribute.String("short_code", current.ShortCode))
+	err := s.next.Replace(ctx, current, updated)
+	endSpan(span, err)
+	return err
+}
+
+// FindByShortCode retrieves a URL by its short code
+func (s *TracedStorage) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	ctx, span := startSpan(ctx, "FindByShortCode", attribute.String("short_code", shortCode))
+	url, err := s.next.FindByShortCode(ctx, shortCode)
+	span.SetAttributes(attribute.Bool("found", err == nil))
+	endSpan(span, err)
+	return url, err
+}
+
+// FindAll retrieves all stored URLs
+func (s *TracedStorage) FindAll(ctx context.Context) ([]*models.URL, error) {
+	ctx, span := startSpan(ctx, "FindAll")
+	urls, err := s.next.FindAll(ctx)
+	span.SetAttributes(attribute.Int("count", len(urls)))
+	endSpan(span, err)
+	return urls, err
+}
+
+// Exists checks if a short code already exists
+func (s *TracedStorage) Exists(ctx context.Context, shortCode string) bool {
+	ctx, span := startSpan(ctx, "Exists", attribute.String("short_code", shortCode))
+	exists := s.next.Exists(ctx, shortCode)
+	span.SetAttributes(attribute.Bool("exists", exists))
+	endSpan(span, nil)
+	return exists
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpanPerRequest(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "none")
+	if _, err := Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	r := mux.NewRouter()
+	r.HandleFunc("/{shortCode}", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	r.Use(otelmux.Middleware(ServiceName))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, shortCode := range []string{"abc123", "xyz789"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+		req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want one per request", len(spans))
+	}
+	for _, span := range spans {
+		if span.Name() != "GET /{shortCode}" {
+			t.Errorf("span name = %q, want the method and route template", span.Name())
+		}
+		if got := span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("trace ID = %s, want the incoming traceparent's", got)
+		}
+	}
+}
+
+func TestInitRejectsUnknownExporter(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "carrier-pigeon")
+	if _, err := Init(context.Background()); err == nil {
+		t.Error("Init accepted an unknown exporter")
+	}
+}
@@ -0,0 +1,423 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Error explains why a destination URL was rejected
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return "invalid URL: " + e.Reason
+}
+
+func invalid(format string, args ...any) error {
+	return &Error{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Options configures which destination URLs are accepted
+type Options struct {
+	MaxLength      int
+	AllowedSchemes []string
+	// BlockedHosts are never valid destinations, along with their subdomains.
+	// They include the shortener's own domains so links cannot point back
+	// at it and loop.
+	BlockedHosts []string
+	// AllowPrivate accepts loopback, private and link-local addresses
+	AllowPrivate bool
+	// ResolveHosts also rejects domains whose DNS records point at
+	// non-public addresses
+	ResolveHosts bool
+}
+
+// OptionsFromEnv reads URL_MAX_LENGTH (2048), URL_ALLOWED_SCHEMES
+// (http,https), URL_BLOCKED_HOSTS, URL_ALLOW_PRIVATE_HOSTS and
+// URL_RESOLVE_HOSTS. The hosts of PUBLIC_SHORT_URL_DOMAIN and
+// PUBLIC_URL_SERVICE are always blocked.
+func OptionsFromEnv() (Options, error) {
+	opts := Options{
+		MaxLength:      2048,
+		AllowedSchemes: envList("URL_ALLOWED_SCHEMES", []string{"http", "https"}),
+		BlockedHosts:   envList("URL_BLOCKED_HOSTS", nil),
+	}
+
+	if value := os.Getenv("URL_MAX_LENGTH"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid URL_MAX_LENGTH %q", value)
+		}
+		opts.MaxLength = n
+	}
+
+	var err error
+	if opts.AllowPrivate, err = envBool("URL_ALLOW_PRIVATE_HOSTS"); err != nil {
+		return opts, err
+	}
+	if opts.ResolveHosts, err = envBool("URL_RESOLVE_HOSTS"); err != nil {
+		return opts, err
+	}
+
+	for _, key := range []string{"PUBLIC_SHORT_URL_DOMAIN", "PUBLIC_URL_SERVICE"} {
+		if value := os.Getenv(key); value != "" {
+			if u, err := url.Parse(value); err == nil && u.Hostname() != "" {
+				opts.BlockedHosts = append(opts.BlockedHosts, u.Hostname())
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+func envBool(key string) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return enabled, nil
+}
+
+func envList(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// URLValidator parses and normalizes destination URLs
+type URLValidator struct {
+	opts         Options
+	schemes      map[string]bool
+	blockedHosts map[string]bool
+	resolver     *net.Resolver
+}
+
+// NewURLValidator creates a validator for the given options
+func NewURLValidator(opts Options) *URLValidator {
+	v := &URLValidator{
+		opts:         opts,
+		schemes:      make(map[string]bool),
+		blockedHosts: make(map[string]bool),
+		resolver:     net.DefaultResolver,
+	}
+	for _, scheme := range opts.AllowedSchemes {
+		v.schemes[strings.ToLower(scheme)] = true
+	}
+	for _, host := range opts.BlockedHosts {
+		if ascii, err := canonicalHost(host); err == nil {
+			v.blockedHosts[ascii] = true
+		}
+	}
+	return v
+}
+
+// Normalize validates a user-supplied destination and returns it in
+// canonical form, with https:// added when no scheme is given and
+// internationalized domains converted to punycode. selfHosts are extra
+// hosts that refer to this service, such as the Host the request came in on.
+// Rejections are returned as *Error.
+func (v *URLValidator) Normalize(ctx context.Context, rawURL string, selfHosts ...string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", invalid("URL is required")
+	}
+	if len(rawURL) > v.opts.MaxLength {
+		return "", invalid("URL is longer than %d characters", v.opts.MaxLength)
+	}
+
+	rawURL = addScheme(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", invalid("could not parse URL")
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !v.schemes[scheme] {
+		return "", invalid("scheme %q is not allowed", u.Scheme)
+	}
+	u.Scheme = scheme
+	if u.Opaque != "" || u.Host == "" {
+		return "", invalid("URL must include a host")
+	}
+	if u.User != nil {
+		// https://trusted.example@evil.example is a classic phishing disguise
+		return "", invalid("URL must not contain credentials")
+	}
+	port := u.Port()
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", invalid("port %q is out of range", port)
+		}
+	}
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if err := v.checkHost(ctx, host, selfHosts); err != nil {
+		return "", err
+	}
+
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	normalized := u.String()
+	if len(normalized) > v.opts.MaxLength {
+		return "", invalid("URL is longer than %d characters", v.opts.MaxLength)
+	}
+	return normalized, nil
+}
+
+// addScheme defaults schemeless input such as "example.com/page" to https
+// without mistaking "example.com:8080" for a scheme
+func addScheme(rawURL string) string {
+	if strings.HasPrefix(rawURL, "//") {
+		return "https:" + rawURL
+	}
+	if strings.Contains(rawURL, "://") {
+		return rawURL
+	}
+	if prefix, rest, ok := strings.Cut(rawURL, ":"); ok && isScheme(prefix) && !startsWithDigit(rest) {
+		// An explicit scheme like javascript: or data:, left for the allowlist
+		return rawURL
+	}
+	return "https://" + rawURL
+}
+
+func isScheme(s string) bool {
+	if s == "" || !isLetter(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !isLetter(c) && !('0' <= c && c <= '9') && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func startsWithDigit(s string) bool {
+	return s != "" && '0' <= s[0] && s[0] <= '9'
+}
+
+// canonicalHost lowercases a host, drops a trailing dot and converts
+// internationalized names to punycode. Hosts that browsers would read as an
+// IPv4 address in shorthand (127.1, 0x7f000001, 2130706433) are rewritten
+// to dotted form so they get the same address checks as any other IP.
+func canonicalHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", invalid("URL must include a host")
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.Zone() != "" {
+			return "", invalid("IPv6 zones are not allowed")
+		}
+		return addr.String(), nil
+	}
+
+	labels := strings.Split(host, ".")
+	if isNumericLabel(labels[len(labels)-1]) {
+		addr, ok := parseIPv4Shorthand(labels)
+		if !ok {
+			return "", invalid("host %q is not a valid address", host)
+		}
+		return addr.String(), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", invalid("host %q is not a valid domain name", host)
+	}
+	return ascii, nil
+}
+
+func isNumericLabel(label string) bool {
+	if label == "" {
+		return false
+	}
+	if rest, ok := strings.CutPrefix(label, "0x"); ok {
+		_, err := strconv.ParseUint("0"+rest, 16, 64)
+		return err == nil
+	}
+	_, err := strconv.ParseUint(label, 10, 64)
+	return err == nil
+}
+
+// parseIPv4Shorthand follows the WHATWG URL rules for IPv4 hosts, where each
+// part may be decimal, octal (leading 0) or hex (0x) and the last part
+// fills the remaining bytes
+func parseIPv4Shorthand(labels []string) (netip.Addr, bool) {
+	if len(labels) > 4 {
+		return netip.Addr{}, false
+	}
+
+	parts := make([]uint64, len(labels))
+	for i, label := range labels {
+		base := 10
+		switch {
+		case strings.HasPrefix(label, "0x"):
+			label, base = label[2:], 16
+		case len(label) > 1 && label[0] == '0':
+			label, base = label[1:], 8
+		}
+		if label == "" {
+			label = "0"
+		}
+		n, err := strconv.ParseUint(label, base, 32)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		parts[i] = n
+	}
+
+	var value uint64
+	for i, part := range parts[:len(parts)-1] {
+		if part > 255 {
+			return netip.Addr{}, false
+		}
+		value |= part << (8 * (3 - i))
+	}
+	last := parts[len(parts)-1]
+	if last >= 1<<(8*(5-len(parts))) {
+		return netip.Addr{}, false
+	}
+	value |= last
+
+	return netip.AddrFrom4([4]byte{byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}), true
+}
+
+func (v *URLValidator) checkHost(ctx context.Context, host string, selfHosts []string) error {
+	if v.isBlocked(host, selfHosts) {
+		return invalid("links to this service are not allowed")
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !v.opts.AllowPrivate && !isPublic(addr) {
+			return invalid("host %s is not a public address", host)
+		}
+		return nil
+	}
+
+	if v.opts.AllowPrivate {
+		return nil
+	}
+	if !strings.Contains(host, ".") || isInternalName(host) {
+		return invalid("host %q is not a public domain", host)
+	}
+
+	if v.opts.ResolveHosts {
+		addrs, err := v.resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil || len(addrs) == 0 {
+			return invalid("host %q does not resolve", host)
+		}
+		for _, addr := range addrs {
+			if !isPublic(addr) {
+				return invalid("host %q resolves to a non-public address", host)
+			}
+		}
+	}
+	return nil
+}
+
+func (v *URLValidator) isBlocked(host string, selfHosts []string) bool {
+	for candidate := host; candidate != ""; {
+		if v.blockedHosts[candidate] {
+			return true
+		}
+		_, parent, ok := strings.Cut(candidate, ".")
+		if !ok {
+			break
+		}
+		candidate = parent
+	}
+
+	for _, self := range selfHosts {
+		if h, _, err := net.SplitHostPort(self); err == nil {
+			self = h
+		}
+		if canonical, err := canonicalHost(self); err == nil && canonical == host {
+			return true
+		}
+	}
+	return false
+}
+
+// internalSuffixes are names reserved for local or private networks
+var internalSuffixes = []string{".localhost", ".local", ".internal", ".lan", ".home.arpa", ".intranet", ".corp"}
+
+func isInternalName(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	for _, suffix := range internalSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nonPublicPrefixes covers special-purpose ranges not already reported by
+// the netip.Addr predicates
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}